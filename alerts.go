@@ -0,0 +1,590 @@
+package alexa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/avs"
+	"github.com/Fruchtgummi/alexa/directives"
+)
+
+// MaxAlertDuration is how long an alert goes on for if nobody stops
+// it.
+const MaxAlertDuration = time.Hour
+
+// alertGrace is how late an alert may still go off, say because
+// nothing was running when it was due. Later than that it's dropped.
+const alertGrace = 30 * time.Minute
+
+// ErrNoScheduler is what Set returns for Alerts that won't be running
+// when new alerts come due.
+var ErrNoScheduler = errors.New("nothing will be running to set it off; use alexa listen")
+
+// AlertsPath is where alerts are kept between runs.
+func AlertsPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".alexa-alerts.json")
+}
+
+// Clock tells the time and waits for it. Alerts have one so that
+// tests can move time on without waiting.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the real time.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time                         { return time.Now() }
+func (SystemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Alert is an alarm, timer or reminder alexa has set.
+type Alert struct {
+	Token         string    `json:"token"`
+	Type          string    `json:"type"`
+	ScheduledTime time.Time `json:"scheduledTime"`
+}
+
+// Alerts keeps the alerts alexa sets, on disk so they survive
+// restarts, and sets them off when they're due.
+type Alerts struct {
+	// Path is where the alerts are saved. Empty means they aren't.
+	Path string
+
+	// Clock is what time it is. Nil means SystemClock.
+	Clock Clock
+
+	// Player plays the tone. It sounds best as a Track; other players
+	// ring the terminal bell instead.
+	Player Player
+
+	// Focus, if set, is asked for the Alerts channel while an alert is
+	// going off.
+	Focus *FocusManager
+
+	// Report is given the events to send to AVS.
+	Report func(avs.Event)
+
+	// Transient means Run stops with the command, long before most
+	// alerts are due, so Set turns new ones down.
+	Transient bool
+
+	lock    sync.Mutex
+	alerts  map[string]Alert
+	active  *activeAlert
+	changed chan struct{}
+}
+
+// activeAlert is the alert going off now.
+type activeAlert struct {
+	Alert
+	stop chan struct{}
+	once sync.Once
+}
+
+func (a *activeAlert) halt() {
+	a.once.Do(func() { close(a.stop) })
+}
+
+// LoadAlerts reads the alerts saved at path, if there are any.
+func LoadAlerts(path string) (*Alerts, error) {
+	a := &Alerts{Path: path}
+	a.init()
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var saved []Alert
+
+	err = json.NewDecoder(f).Decode(&saved)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	for _, al := range saved {
+		a.alerts[al.Token] = al
+	}
+
+	return a, nil
+}
+
+// init makes what an Alerts not from LoadAlerts is missing. It's
+// called with the lock held, or before a is shared.
+func (a *Alerts) init() {
+	if a.alerts == nil {
+		a.alerts = make(map[string]Alert)
+	}
+
+	if a.changed == nil {
+		a.changed = make(chan struct{}, 1)
+	}
+}
+
+// save writes the alerts to Path. It's called with the lock held.
+func (a *Alerts) save() error {
+	if a.Path == "" {
+		return nil
+	}
+
+	f, err := os.Create(a.Path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(a.sorted())
+}
+
+// keep saves the alerts after Run or Delete changed them, warning if
+// it can't. It's called with the lock held.
+func (a *Alerts) keep() {
+	err := a.save()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: couldn't save alerts: %s\n", err)
+	}
+}
+
+// sorted is every alert, soonest first.
+func (a *Alerts) sorted() []Alert {
+	all := make([]Alert, 0, len(a.alerts))
+	for _, al := range a.alerts {
+		all = append(all, al)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].ScheduledTime.Before(all[j].ScheduledTime)
+	})
+
+	return all
+}
+
+func (a *Alerts) clock() Clock {
+	if a.Clock == nil {
+		return SystemClock{}
+	}
+
+	return a.Clock
+}
+
+func (a *Alerts) report(name string, payload interface{}) {
+	if a.Report != nil {
+		a.Report(avs.NewEvent("Alerts", name, payload))
+	}
+}
+
+// wake has Run look at the alerts again.
+func (a *Alerts) wake() {
+	select {
+	case a.changed <- struct{}{}:
+	default:
+	}
+}
+
+type alertToken struct {
+	Token string `json:"token"`
+}
+
+// Handle registers the Alerts directives with ds.
+func (a *Alerts) Handle(ds *directives.Dispatcher) {
+	ds.Handle("Alerts", "SetAlert", func(d directives.Directive) error {
+		s := d.(*directives.SetAlert)
+
+		at, err := time.Parse(time.RFC3339, s.ScheduledTime)
+		if err == nil {
+			err = a.Set(Alert{Token: s.Token, Type: s.Type, ScheduledTime: at})
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: couldn't set %s alert: %s\n", s.Type, err)
+			a.report("SetAlertFailed", alertToken{s.Token})
+			return nil
+		}
+
+		a.report("SetAlertSucceeded", alertToken{s.Token})
+		return nil
+	})
+
+	ds.Handle("Alerts", "DeleteAlert", func(d directives.Directive) error {
+		token := d.(*directives.DeleteAlert).Token
+
+		if !a.Delete(token) {
+			a.report("DeleteAlertFailed", alertToken{token})
+			return nil
+		}
+
+		a.report("DeleteAlertSucceeded", alertToken{token})
+		return nil
+	})
+}
+
+// Set adds al, or moves it if there's already one with its token. If
+// al can't be saved it's left as it was.
+func (a *Alerts) Set(al Alert) error {
+	if a.Transient {
+		return ErrNoScheduler
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.init()
+
+	old, had := a.alerts[al.Token]
+	a.alerts[al.Token] = al
+
+	err := a.save()
+	if err != nil {
+		if had {
+			a.alerts[al.Token] = old
+		} else {
+			delete(a.alerts, al.Token)
+		}
+
+		return err
+	}
+
+	a.wake()
+
+	return nil
+}
+
+// Delete removes the alert with token, stopping it if it's going off.
+// It returns whether there was one.
+func (a *Alerts) Delete(token string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.active != nil && a.active.Token == token {
+		a.active.halt()
+		return true
+	}
+
+	_, ok := a.alerts[token]
+	if !ok {
+		return false
+	}
+
+	delete(a.alerts, token)
+	a.wake()
+	a.keep()
+
+	return true
+}
+
+// Stop stops the alert going off, returning whether there was one.
+func (a *Alerts) Stop() bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.active == nil {
+		return false
+	}
+
+	a.active.halt()
+	return true
+}
+
+// List returns every alert, soonest first.
+func (a *Alerts) List() []Alert {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.sorted()
+}
+
+type alertState struct {
+	Token         string `json:"token"`
+	Type          string `json:"type"`
+	ScheduledTime string `json:"scheduledTime"`
+}
+
+func (al Alert) state() alertState {
+	return alertState{al.Token, al.Type, al.ScheduledTime.Format(time.RFC3339)}
+}
+
+// State is the Alerts.AlertsState to send as context.
+func (a *Alerts) State() avs.State {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var (
+		all    = []alertState{}
+		active = []alertState{}
+	)
+
+	for _, al := range a.sorted() {
+		all = append(all, al.state())
+	}
+
+	if a.active != nil {
+		active = append(active, a.active.state())
+	}
+
+	return avs.State{
+		Header: avs.Header{Namespace: "Alerts", Name: "AlertsState"},
+		Payload: map[string]interface{}{
+			"allAlerts":    all,
+			"activeAlerts": active,
+		},
+	}
+}
+
+// Run sets alerts off as they come due, one at a time, until ctx is
+// done.
+func (a *Alerts) Run(ctx context.Context) error {
+	a.lock.Lock()
+	a.init()
+	a.lock.Unlock()
+
+	for {
+		a.lock.Lock()
+		next, ok := a.next()
+		a.lock.Unlock()
+
+		var due <-chan time.Time
+
+		if ok {
+			wait := next.ScheduledTime.Sub(a.clock().Now())
+			if wait <= 0 {
+				a.fire(ctx, next)
+
+				if ctx.Err() != nil {
+					return nil
+				}
+
+				continue
+			}
+
+			due = a.clock().After(wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-a.changed:
+		case <-due:
+		}
+	}
+}
+
+// next is the soonest alert. It's called with the lock held.
+func (a *Alerts) next() (Alert, bool) {
+	all := a.sorted()
+	if len(all) == 0 {
+		return Alert{}, false
+	}
+
+	return all[0], true
+}
+
+// fire sets al off and waits for it to be stopped, or to time out.
+func (a *Alerts) fire(ctx context.Context, al Alert) {
+	if a.clock().Now().Sub(al.ScheduledTime) > alertGrace {
+		a.lock.Lock()
+		delete(a.alerts, al.Token)
+		a.keep()
+		a.lock.Unlock()
+
+		fmt.Fprintf(os.Stderr, "warning: dropped %s alert due at %s\n", al.Type, al.ScheduledTime.Format(time.Stamp))
+		return
+	}
+
+	active := &activeAlert{Alert: al, stop: make(chan struct{})}
+
+	a.lock.Lock()
+	a.active = active
+	a.lock.Unlock()
+
+	a.report("AlertStarted", alertToken{al.Token})
+
+	if a.Focus != nil {
+		var follow Activity
+		if a.Player != nil {
+			follow = PlayerFocus(a.Player)
+		}
+
+		release := a.Focus.Acquire(AlertsChannel, FocusFunc(func(focus Focus) {
+			switch focus {
+			case FocusForeground:
+				a.report("AlertEnteredForeground", alertToken{al.Token})
+			case FocusDucked, FocusPaused:
+				a.report("AlertEnteredBackground", alertToken{al.Token})
+			}
+
+			if follow != nil {
+				follow.FocusChanged(focus)
+			}
+		}))
+
+		defer release()
+	}
+
+	sounded := make(chan struct{})
+
+	go func() {
+		defer close(sounded)
+		a.sound(al.Type, active.stop)
+	}()
+
+	// Quitting halts the alert but keeps it, to go off again next
+	// time, rather than have it look dismissed.
+	quit := false
+
+	select {
+	case <-active.stop:
+	case <-a.clock().After(MaxAlertDuration):
+	case <-ctx.Done():
+		quit = true
+	case <-sounded:
+	}
+
+	active.halt()
+
+	if a.Player != nil {
+		a.Player.Stop()
+	}
+
+	<-sounded
+
+	a.lock.Lock()
+	a.active = nil
+
+	if quit {
+		a.lock.Unlock()
+		return
+	}
+
+	delete(a.alerts, al.Token)
+	a.keep()
+	a.lock.Unlock()
+
+	a.report("AlertStopped", alertToken{al.Token})
+}
+
+// sourcePlayer is a Player that can play made up audio.
+type sourcePlayer interface {
+	PlaySource(src AudioSource) error
+}
+
+// sound plays the tone for an alert of type typ until stop is closed.
+func (a *Alerts) sound(typ string, stop <-chan struct{}) {
+	if p, ok := a.Player.(sourcePlayer); ok {
+		err := p.PlaySource(&toneLoop{pattern: alertTone(typ), stop: stop})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		}
+
+		return
+	}
+
+	for {
+		fmt.Print("\a")
+
+		select {
+		case <-stop:
+			return
+		case <-a.clock().After(time.Second):
+		}
+	}
+}
+
+// alertTone is one round of the tone for an alert of type typ: quick
+// beeps for alarms, slower ones for timers and a chime for
+// reminders.
+func alertTone(typ string) []Segment {
+	var pattern []Segment
+
+	switch typ {
+	case directives.AlertTimer:
+		for i := 0; i < 2; i++ {
+			pattern = append(pattern, Tone(660, 0.4, 250*time.Millisecond), Silence(150*time.Millisecond))
+		}
+	case directives.AlertReminder:
+		pattern = append(pattern, Tone(784, 0.3, 300*time.Millisecond), Tone(523, 0.3, 500*time.Millisecond))
+	default:
+		for i := 0; i < 4; i++ {
+			pattern = append(pattern, Tone(880, 0.4, 100*time.Millisecond), Silence(100*time.Millisecond))
+		}
+	}
+
+	return append(pattern, Silence(time.Second))
+}
+
+// toneLoop plays a pattern of tones over and over until stop is
+// closed.
+type toneLoop struct {
+	pattern []Segment
+	stop    <-chan struct{}
+	gen     *GeneratorSource
+}
+
+const toneRate = 16000
+
+func (t *toneLoop) SampleRate() int { return toneRate }
+func (t *toneLoop) Channels() int   { return 1 }
+func (t *toneLoop) Close() error    { return nil }
+
+func (t *toneLoop) Read(buf []int16) (int, error) {
+	select {
+	case <-t.stop:
+		return 0, io.EOF
+	default:
+	}
+
+	for {
+		if t.gen == nil {
+			t.gen = NewGeneratorSource(toneRate, t.pattern...)
+		}
+
+		n, err := t.gen.Read(buf)
+		if err != io.EOF {
+			return n, err
+		}
+
+		t.gen = nil
+	}
+}
+
+// AlertsCommand lists the alerts alexa has set. They go off while
+// listen is running.
+type AlertsCommand struct {
+}
+
+func (c *AlertsCommand) Execute(args []string) error {
+	a, err := LoadAlerts(AlertsPath())
+	if err != nil {
+		return err
+	}
+
+	all := a.List()
+	if len(all) == 0 {
+		fmt.Println("no alerts")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	for _, al := range all {
+		fmt.Fprintf(w, "%s\t%s\tin %s\n", al.Type, al.ScheduledTime.Local().Format("Mon Jan 2 15:04:05"), time.Until(al.ScheduledTime).Round(time.Second))
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,497 @@
+package alexa
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/avs"
+	"github.com/Fruchtgummi/alexa/avs/avstest"
+	"github.com/Fruchtgummi/alexa/directives"
+)
+
+// events collects the events reported to AVS.
+type events struct {
+	lock  sync.Mutex
+	names []string
+}
+
+func (e *events) report(ev avs.Event) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.names = append(e.names, ev.Header.Namespace+"."+ev.Header.Name)
+}
+
+func (e *events) list() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return append([]string(nil), e.names...)
+}
+
+// has is whether name was reported.
+func (e *events) has(name string) bool {
+	for _, n := range e.list() {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// await waits for name to be reported.
+func (e *events) await(t *testing.T, name string) {
+	for deadline := time.Now().Add(5 * time.Second); !e.has(name); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no %s in %v", name, e.list())
+		}
+	}
+}
+
+// fakeClock is a Clock that only moves on when it's told to.
+type fakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{c.now.Add(d), ch})
+
+	return ch
+}
+
+// Advance moves the time on by d, going off for whoever was waiting
+// until then.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+
+	var waiting []fakeWaiter
+
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+
+		w.ch <- c.now
+	}
+
+	c.waiters = waiting
+}
+
+// await waits for n to be waiting on the clock.
+func (c *fakeClock) await(t *testing.T, n int) {
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		c.lock.Lock()
+		waiting := len(c.waiters)
+		c.lock.Unlock()
+
+		if waiting >= n {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("%d waiting on the clock, want %d", waiting, n)
+		}
+	}
+}
+
+// tonePlayer plays alert tones by reading them until they stop.
+type tonePlayer struct {
+	lock    sync.Mutex
+	samples int
+}
+
+func (p *tonePlayer) PlaySource(src AudioSource) error {
+	buf := make([]int16, 160)
+
+	for {
+		n, err := src.Read(buf)
+
+		p.lock.Lock()
+		p.samples += n
+		p.lock.Unlock()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (p *tonePlayer) Play(r io.Reader) error  { return nil }
+func (p *tonePlayer) Stop() error             { return nil }
+func (p *tonePlayer) Pause() error            { return nil }
+func (p *tonePlayer) Resume() error           { return nil }
+func (p *tonePlayer) Position() time.Duration { return 0 }
+
+func (p *tonePlayer) played() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.samples
+}
+
+// running runs a until the test is over, or until the func it returns
+// is called.
+func running(t *testing.T, a *Alerts) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		a.Run(ctx)
+	}()
+
+	quit := func() {
+		cancel()
+		<-done
+	}
+
+	t.Cleanup(quit)
+
+	return quit
+}
+
+func tempAlerts(t *testing.T) *Alerts {
+	dir, err := ioutil.TempDir("", "alerts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	a, err := LoadAlerts(filepath.Join(dir, "alerts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a
+}
+
+func TestSetAlertFailsOnce(t *testing.T) {
+	var (
+		a  = tempAlerts(t)
+		ev events
+		ds = directives.Dispatcher{Report: ev.report}
+	)
+
+	a.Report = ev.report
+	a.Handle(&ds)
+
+	ds.Dispatch(avstest.Directive("Alerts", "SetAlert", "", map[string]string{
+		"token":         "alarm",
+		"type":          directives.AlertAlarm,
+		"scheduledTime": "tomorrow",
+	}), nil)
+
+	got := ev.list()
+	if len(got) != 1 || got[0] != "Alerts.SetAlertFailed" {
+		t.Errorf("got events %v, want just Alerts.SetAlertFailed", got)
+	}
+}
+
+func TestAlertsFireWhenDue(t *testing.T) {
+	var (
+		a     = tempAlerts(t)
+		clock = newFakeClock()
+		tone  = &tonePlayer{}
+		ev    events
+	)
+
+	a.Clock, a.Player, a.Report = clock, tone, ev.report
+
+	err := a.Set(Alert{Token: "timer", Type: directives.AlertTimer, ScheduledTime: clock.Now().Add(5 * time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	running(t, a)
+
+	clock.await(t, 1)
+	clock.Advance(4 * time.Minute)
+	time.Sleep(20 * time.Millisecond)
+
+	if ev.has("Alerts.AlertStarted") {
+		t.Fatal("the timer went off a minute early")
+	}
+
+	clock.Advance(time.Minute)
+	ev.await(t, "Alerts.AlertStarted")
+
+	for deadline := time.Now().Add(5 * time.Second); tone.played() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the timer went off without a sound")
+		}
+	}
+
+	if !a.Stop() {
+		t.Fatal("Stop found nothing going off")
+	}
+
+	ev.await(t, "Alerts.AlertStopped")
+
+	if all := a.List(); len(all) != 0 {
+		t.Errorf("%v left after going off", all)
+	}
+
+	saved, err := LoadAlerts(a.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if all := saved.List(); len(all) != 0 {
+		t.Errorf("%v still saved after going off", all)
+	}
+}
+
+func TestAlertsKeptOnQuit(t *testing.T) {
+	var (
+		a     = tempAlerts(t)
+		clock = newFakeClock()
+		ev    events
+	)
+
+	a.Clock, a.Player, a.Report = clock, &tonePlayer{}, ev.report
+
+	err := a.Set(Alert{Token: "alarm", Type: directives.AlertAlarm, ScheduledTime: clock.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quit := running(t, a)
+
+	clock.Advance(time.Minute)
+	ev.await(t, "Alerts.AlertStarted")
+	quit()
+
+	if ev.has("Alerts.AlertStopped") {
+		t.Error("quitting told AVS the alarm was stopped")
+	}
+
+	saved, err := LoadAlerts(a.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if all := saved.List(); len(all) != 1 || all[0].Token != "alarm" {
+		t.Errorf("saved %v after quitting, want the alarm", all)
+	}
+}
+
+func TestAlertsDropLateOnes(t *testing.T) {
+	var (
+		a     = tempAlerts(t)
+		clock = newFakeClock()
+		ev    events
+	)
+
+	a.Clock, a.Player, a.Report = clock, &tonePlayer{}, ev.report
+
+	err := a.Set(Alert{Token: "alarm", Type: directives.AlertAlarm, ScheduledTime: clock.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.Set(Alert{Token: "timer", Type: directives.AlertTimer, ScheduledTime: clock.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	running(t, a)
+
+	// Once the late alarm is dropped, Run waits for the timer.
+	clock.await(t, 1)
+
+	if ev.has("Alerts.AlertStarted") {
+		t.Error("an alarm an hour late went off")
+	}
+
+	saved, err := LoadAlerts(a.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if all := saved.List(); len(all) != 1 || all[0].Token != "timer" {
+		t.Errorf("saved %v, want just the timer", all)
+	}
+}
+
+func TestAlertsReload(t *testing.T) {
+	var (
+		a     = tempAlerts(t)
+		clock = newFakeClock()
+		set   = []Alert{
+			{Token: "reminder", Type: directives.AlertReminder, ScheduledTime: clock.Now().Add(time.Hour)},
+			{Token: "alarm", Type: directives.AlertAlarm, ScheduledTime: clock.Now().Add(time.Minute)},
+		}
+	)
+
+	for _, al := range set {
+		err := a.Set(al)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := a.Set(Alert{Token: "alarm", Type: directives.AlertAlarm, ScheduledTime: clock.Now().Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !a.Delete("reminder") {
+		t.Fatal("Delete didn't find the reminder")
+	}
+
+	saved, err := LoadAlerts(a.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all := saved.List()
+	if len(all) != 1 || all[0].Token != "alarm" || !all[0].ScheduledTime.Equal(clock.Now().Add(2*time.Hour)) {
+		t.Errorf("reloaded %v, want the alarm as moved", all)
+	}
+}
+
+func TestAlertsSetUnsaved(t *testing.T) {
+	a := &Alerts{Path: filepath.Join(os.DevNull, "alerts.json")}
+
+	err := a.Set(Alert{Token: "alarm", Type: directives.AlertAlarm, ScheduledTime: time.Now().Add(time.Hour)})
+	if err == nil {
+		t.Fatal("set an alert that couldn't be saved")
+	}
+
+	if all := a.List(); len(all) != 0 {
+		t.Errorf("%v kept though it couldn't be saved", all)
+	}
+}
+
+func TestAlertsWithoutLoad(t *testing.T) {
+	var (
+		a     Alerts
+		clock = newFakeClock()
+		ev    events
+	)
+
+	a.Clock, a.Player, a.Report = clock, &tonePlayer{}, ev.report
+
+	err := a.Set(Alert{Token: "timer", Type: directives.AlertTimer, ScheduledTime: clock.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	running(t, &a)
+
+	clock.Advance(time.Minute)
+	ev.await(t, "Alerts.AlertStarted")
+	a.Stop()
+	ev.await(t, "Alerts.AlertStopped")
+}
+
+func TestAlertsBellKeepsTime(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		a      = Alerts{Clock: newFakeClock()}
+		clock  = a.Clock.(*fakeClock)
+		stop   = make(chan struct{})
+		rang   = make(chan struct{})
+		stdout = os.Stdout
+	)
+
+	os.Stdout = w
+
+	go func() {
+		defer close(rang)
+		a.sound(directives.AlertAlarm, stop)
+	}()
+
+	defer func() {
+		close(stop)
+		<-rang
+
+		os.Stdout = stdout
+		w.Close()
+		r.Close()
+	}()
+
+	bells := bufio.NewReader(r)
+
+	for i := 0; i < 3; i++ {
+		b, err := bells.ReadByte()
+		if err != nil || b != '\a' {
+			t.Fatalf("rang %q, %v", b, err)
+		}
+
+		clock.await(t, 1)
+		clock.Advance(time.Second)
+	}
+}
+
+func TestSetAlertNeedsScheduler(t *testing.T) {
+	var (
+		a  = tempAlerts(t)
+		ev events
+		ds = directives.Dispatcher{Report: ev.report}
+	)
+
+	a.Transient = true
+	a.Report = ev.report
+	a.Handle(&ds)
+
+	ds.Dispatch(avstest.Directive("Alerts", "SetAlert", "", map[string]string{
+		"token":         "timer",
+		"type":          directives.AlertTimer,
+		"scheduledTime": time.Now().Add(time.Hour).Format(time.RFC3339),
+	}), nil)
+
+	got := ev.list()
+	if len(got) != 1 || got[0] != "Alerts.SetAlertFailed" {
+		t.Errorf("got events %v, want just Alerts.SetAlertFailed", got)
+	}
+
+	if all := a.List(); len(all) != 0 {
+		t.Errorf("set %v with nothing to set it off", all)
+	}
+}
@@ -2,21 +2,25 @@ package alexa
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
-	"mime"
-	"mime/multipart"
-	"net/http"
-	"net/textproto"
-	"os/exec"
+	"os"
 	"sort"
 	"time"
 
-	"github.com/Fruchtgummi/alexa/config"
+	"github.com/Fruchtgummi/alexa/audio/wav"
+	"github.com/Fruchtgummi/alexa/avs"
+	"github.com/Fruchtgummi/alexa/directives"
 	"github.com/fatih/color"
 )
 
 const DefaultQuietFrames = 30
 
+// DefaultExpectSpeechTimeout is how long to wait for the answer to a
+// question of alexa's that doesn't say how long to wait.
+const DefaultExpectSpeechTimeout = 8 * time.Second
+
 func max(buf []int16) int16 {
 	var max int16
 
@@ -94,6 +98,19 @@ func nine95(buf, tmp []int16) int16 {
 }
 
 type AskCommand struct {
+	Latency  bool   `long:"latency" description:"show the time from the end of speech to alexa's first byte"`
+	Buffered bool   `long:"buffered" description:"capture the whole question before sending it"`
+	Input    string `long:"input" description:"WAV file to ask, or - for raw 16kHz mono L16 on stdin"`
+	Record   string `long:"record" description:"save what is sent to alexa as a WAV file"`
+
+	InputDevice  string `long:"input-device" description:"microphone to use, by index, name or part of a name"`
+	OutputDevice string `long:"output-device" description:"speaker to use, by index, name or part of a name"`
+	Player       string `long:"player" description:"how to play alexa's answers" choice:"portaudio" choice:"mpg123" default:"portaudio"`
+	VAD          string `long:"vad" description:"how to tell when you're talking" choice:"flux" choice:"energy" choice:"band" default:"flux"`
+
+	MaxWait   time.Duration `long:"max-wait" default:"10s" description:"how long to wait for you to start talking"`
+	MaxLength time.Duration `long:"max-length" default:"30s" description:"longest question to listen to"`
+	BargeIn   bool          `long:"barge-in" description:"let you interrupt the answer by talking over it"`
 }
 
 type State int
@@ -102,6 +119,9 @@ const (
 	Waiting State = iota
 	Listening
 	Asking
+
+	// Interrupted is when the user has barged in on an answer.
+	Interrupted
 )
 
 func (r *AskCommand) Execute(args []string) error {
@@ -109,6 +129,65 @@ func (r *AskCommand) Execute(args []string) error {
 
 	var opts ListenOpts
 
+	opts.Buffered = r.Buffered
+	opts.MaxInitialSilence = r.MaxWait
+	opts.MaxUtterance = r.MaxLength
+
+	if r.BargeIn {
+		opts.BargeIn = &BargeIn{}
+	}
+
+	var err error
+
+	opts.Detector, err = NewVoiceDetector(r.VAD)
+	if err != nil {
+		return err
+	}
+
+	opts.InputDevice, opts.OutputDevice, err = configuredDevices(r.InputDevice, r.OutputDevice)
+	if err != nil {
+		return err
+	}
+
+	output, err := OpenOutput(r.Player, opts.OutputDevice)
+	if err != nil {
+		return err
+	}
+
+	opts.Player = output()
+
+	if r.Input != "" {
+		src, err := OpenInput(r.Input, opts.InputDevice)
+		if err != nil {
+			return err
+		}
+
+		defer src.Close()
+
+		opts.Source = src
+	}
+
+	if r.Record != "" {
+		rec, err := wav.Create(r.Record, wav.L16)
+		if err != nil {
+			return err
+		}
+
+		defer rec.Close()
+
+		opts.Record = rec
+	}
+
+	opts.Lost = func(s CaptureStats) {
+		fmt.Fprintf(os.Stderr, "warning: lost audio, %d frames dropped, %d overflows\n", s.Dropped, s.Overflows)
+	}
+
+	if r.Latency {
+		opts.Latency = func(d time.Duration) {
+			fmt.Printf("latency: %s\n", d)
+		}
+	}
+
 	muted, err := OSXMuted()
 	if err == nil && !muted {
 		OSXMute()
@@ -124,133 +203,421 @@ func (r *AskCommand) Execute(args []string) error {
 		case Asking:
 			OSXUnmute()
 			c.Println("Frage...")
+		case Interrupted:
+			c.Println("Ja?")
 		}
 	}
 
-	return Listen(opts)
-}
+	ctx, cancel := interruptible()
+	defer cancel()
 
-type ListenOpts struct {
-	State         func(State)
-	QuietDuration time.Duration
-}
+	client := Globals.Client()
 
-func Listen(opts ListenOpts) error {
-	buf, err := ListenIntoBuffer(opts)
+	err = setUpDevice(client, output, &opts)
 	if err != nil {
 		return err
 	}
 
-	if opts.State != nil {
-		opts.State(Asking)
-	}
-
-	url := "https://access-alexa-na.amazon.com/v1/avs/speechrecognizer/recognize"
-	d := `{
-		"messageHeader": {
-			"deviceContext": [
-			{
-				"name": "playbackState",
-				"namespace": "AudioPlayer",
-				"payload": {
-					"streamId": "",
-					"offsetInMilliseconds": "0",
-					"playerActivity": "IDLE"
-				}
-			}
-			]
-		},
-		"messageBody": {
-			"profile": "alexa-close-talk",
-			"locale": "en-us",
-			"format": "audio/L16; rate=16000; channels=1"
-		}
-	}`
-
-	body := new(bytes.Buffer)
-	writer := multipart.NewWriter(body)
+	defer opts.AudioPlayer.Close()
 
-	h := make(textproto.MIMEHeader)
-	h.Set("Content-Disposition", `form-data; name="request"`)
-	h.Set("Content-Type", "application/json; charset=UTF-8")
+	// ask is gone long before most alerts are due, so it only sets off
+	// ones already late and leaves setting new ones to listen.
+	opts.Alerts.Transient = true
+	go opts.Alerts.Run(ctx)
 
-	part, err := writer.CreatePart(h)
+	err = Listen(ctx, client, opts)
 	if err != nil {
 		return err
 	}
 
-	part.Write([]byte(d))
+	select {
+	case <-opts.AudioPlayer.Idle():
+		return nil
+	default:
+	}
 
-	h = make(textproto.MIMEHeader)
-	h.Set("Content-Disposition", `form-data; name="audio"`)
-	h.Set("Content-Type", "audio/L16; rate=16000; channels=1")
+	c.Println("Spiele... (next, previous, pause, play; ^C beendet)")
 
-	part, err = writer.CreatePart(h)
-	if err != nil {
-		return err
+	go Controls(ctx, client, os.Stdin, opts.Directives, opts.Alerts)
+
+	select {
+	case <-opts.AudioPlayer.Idle():
+	case <-ctx.Done():
 	}
 
-	part.Write(buf.Bytes())
+	return nil
+}
 
-	err = writer.Close()
-	if err != nil {
-		return err
+// setUpDevice gives opts an AudioPlayer and the saved Alerts, each
+// playing on its own player from output under one FocusManager, and a
+// Dispatcher for them. It has c send their state as context.
+func setUpDevice(c *Client, output func() Player, opts *ListenOpts) error {
+	report := func(ev avs.Event) {
+		_, err := c.Send(context.Background(), ev, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: couldn't send %s.%s: %s\n", ev.Header.Namespace, ev.Header.Name, err)
+		}
 	}
 
-	req, err := http.NewRequest("POST", url, body)
+	alerts, err := LoadAlerts(AlertsPath())
 	if err != nil {
 		return err
 	}
 
-	token, err := config.GetToken()
-	if err != nil {
-		return err
+	focus := &FocusManager{}
+
+	player := NewAudioPlayer(output(), report)
+	player.Focus = focus
+
+	alerts.Player = output()
+	alerts.Focus = focus
+	alerts.Report = report
+
+	c.Context = func() []avs.State {
+		states := withState(avs.DefaultContext(), player.State())
+		return withState(states, alerts.State())
 	}
 
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
+	ds := &directives.Dispatcher{Report: report}
+	player.Handle(ds)
+	alerts.Handle(ds)
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	opts.Focus = focus
+	opts.AudioPlayer = player
+	opts.Alerts = alerts
+	opts.Directives = ds
+
+	return nil
+}
+
+type ListenOpts struct {
+	State func(State)
+
+	// Detector decides which frames are speech. Nil means a
+	// FluxDetector.
+	Detector VoiceDetector
+
+	// StartDuration, Hangover and QuietDuration set up the Endpointer
+	// deciding when the utterance starts and ends.
+	StartDuration time.Duration
+	Hangover      time.Duration
+	QuietDuration time.Duration
+
+	// Endpointer, if set, is used for every utterance rather than a
+	// new one, so that the noise floor it has learnt carries over from
+	// one to the next. The durations above are set on it.
+	Endpointer *Endpointer
+
+	// MaxInitialSilence is how long to wait for the user to start
+	// talking, and MaxUtterance how long they may talk for; zero means
+	// no limit. Deadline, if set, is when to give up either way.
+	MaxInitialSilence time.Duration
+	MaxUtterance      time.Duration
+	Deadline          time.Time
+
+	// PreRoll is how much audio from before the speech started is sent
+	// with it, and TrailingSilence how much of the quiet after it.
+	// Zero means DefaultPreRoll and DefaultTrailingSilence.
+	PreRoll         time.Duration
+	TrailingSilence time.Duration
+
+	// BargeIn, if set, lets the user interrupt the answer by talking
+	// over it, which starts another question.
+	BargeIn *BargeIn
+
+	// Lost is told whenever the microphone loses audio, with the
+	// totals so far.
+	Lost func(CaptureStats)
+
+	// Noise is told the noise floor and how far above it the audio is,
+	// both in dB, for every frame.
+	Noise func(floor, snr float64)
+
+	// Source is where the audio comes from. Nil means the default
+	// microphone.
+	Source AudioSource
+
+	// Record, if set, gets a copy of the audio as it is sent.
+	Record *wav.Writer
+
+	// InputDevice and OutputDevice pick the devices to use when there
+	// is no Source, see FindDevice. Empty means the system default.
+	InputDevice  string
+	OutputDevice string
+
+	// Player plays the answer. Nil means a PortAudioPlayer on
+	// OutputDevice.
+	Player Player
+
+	// AudioPlayer, if set, plays the music and such that comes with
+	// answers.
+	AudioPlayer *AudioPlayer
+
+	// Alerts, if set, keeps the alerts that come with answers.
+	Alerts *Alerts
+
+	// Directives, if set, handles the directives that come outside of
+	// a dialog: those pushed down the downchannel and the answers to
+	// Controls.
+	Directives *directives.Dispatcher
+
+	// Focus, if set, is asked for the Dialog channel while the user
+	// and alexa are talking, so whatever else is playing ducks.
+	Focus *FocusManager
+
+	// Buffered captures the whole utterance before sending any of it,
+	// rather than streaming it up while the user is still talking.
+	Buffered bool
+
+	// Latency is told how long it took from the end of speech to the
+	// first byte of the response.
+	Latency func(time.Duration)
+
+	// expect is the ExpectSpeech being answered, if any.
+	expect *directives.ExpectSpeech
+}
+
+// listenInto captures an utterance into w, reporting when it's done
+// and returning when the speech ended.
+func listenInto(ctx context.Context, w io.Writer, opts ListenOpts) (time.Time, error) {
+	err := ListenInto(ctx, w, opts)
+
+	end := time.Now()
+
+	if err == nil && opts.State != nil {
+		opts.State(Asking)
 	}
 
-	defer resp.Body.Close()
+	return end, err
+}
 
-	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
-	if err != nil {
-		return err
+// Listen asks alexa a question and plays her answer. If she asks
+// something back, the user's answer is listened for too, and so on.
+// With opts.BargeIn set, the user can also interrupt an answer with
+// another question.
+func Listen(ctx context.Context, c *Client, opts ListenOpts) error {
+	// Follow-ups are asked in the same room as the question.
+	if opts.Endpointer == nil {
+		opts.Endpointer = &Endpointer{}
+	}
+
+	if opts.Focus != nil {
+		release := opts.Focus.Acquire(DialogChannel, FocusFunc(func(Focus) {}))
+		defer release()
 	}
 
-	mr := multipart.NewReader(resp.Body, params["boundary"])
+	// The microphone stays open for the answers too, to hear the user
+	// interrupting them.
+	if opts.BargeIn != nil {
+		if opts.Source == nil {
+			mic, err := OpenCapture(opts.InputDevice, 0)
+			if err != nil {
+				return err
+			}
+
+			defer mic.Close()
+
+			opts.Source = mic
+		}
+
+		opts.Source = NewL16Source(opts.Source)
+	}
+
+	var (
+		src     = opts.Source
+		maxWait = opts.MaxInitialSilence
+	)
+
 	for {
-		p, err := mr.NextPart()
+		t, err := listenOnce(ctx, c, opts)
+		if opts.expect != nil && err == ErrNoSpeech {
+			_, err = c.Send(ctx, avs.NewEvent("SpeechRecognizer", "ExpectSpeechTimedOut", nil), nil)
+			return err
+		}
+
 		if err != nil {
-			if err == io.EOF {
-				return nil
-			}
 			return err
 		}
 
-		if p.Header.Get("Content-Type") == "audio/mpeg" {
-			cmd := exec.Command("mpg123", "-q", "-")
-			ip, err := cmd.StdinPipe()
-			if err != nil {
-				return err
+		switch {
+		case t.barged != nil:
+			if opts.State != nil {
+				opts.State(Interrupted)
 			}
 
-			err = cmd.Start()
-			if err != nil {
-				return err
+			opts.Source = &prerolledSource{AudioSource: src, pre: t.barged}
+			opts.MaxInitialSilence = maxWait
+			opts.expect = nil
+		case t.expect != nil:
+			opts.Source = src
+			opts.MaxInitialSilence = time.Duration(t.expect.TimeoutInMilliseconds) * time.Millisecond
+			opts.expect = t.expect
+
+			// Zero would be waiting forever.
+			if opts.MaxInitialSilence <= 0 {
+				opts.MaxInitialSilence = DefaultExpectSpeechTimeout
 			}
+		default:
+			return nil
+		}
+	}
+}
 
-			io.Copy(ip, p)
+// turn is how an answer ended: with the user barging in on it, and
+// the audio from just before they did, or with alexa expecting speech.
+type turn struct {
+	barged []int16
+	expect *directives.ExpectSpeech
+}
+
+// listenOnce asks a question and plays the answer.
+func listenOnce(ctx context.Context, c *Client, opts ListenOpts) (turn, error) {
+	var (
+		audio       io.Reader
+		endOfSpeech time.Time
+		captured    = make(chan error, 1)
+	)
 
-			ip.Close()
+	if opts.Buffered {
+		var buf bytes.Buffer
 
-			return cmd.Wait()
+		end, err := listenInto(ctx, &buf, opts)
+		if err != nil {
+			return turn{}, err
 		}
+
+		audio = &buf
+		endOfSpeech = end
+		captured <- nil
+	} else {
+		pr, pw := io.Pipe()
+		defer pr.Close()
+
+		go func() {
+			end, err := listenInto(ctx, pw, opts)
+			endOfSpeech = end
+			captured <- err
+			pw.CloseWithError(err)
+		}()
+
+		audio = pr
 	}
 
-	return nil
+	var (
+		resp *Response
+		err  error
+	)
+
+	if opts.expect != nil {
+		resp, err = c.RecognizeExpected(ctx, audio, opts.expect.Initiator)
+	} else {
+		resp, err = c.Recognize(ctx, audio)
+	}
+
+	if err != nil {
+		// Rather the reason the capture stopped than what the request
+		// made of it.
+		select {
+		case cerr := <-captured:
+			if cerr != nil {
+				return turn{}, cerr
+			}
+		default:
+		}
+
+		return turn{}, err
+	}
+
+	// The capture is done with the source before anything else reads
+	// from it.
+	<-captured
+
+	if opts.Latency != nil {
+		opts.Latency(resp.FirstByte.Sub(endOfSpeech))
+	}
+
+	var (
+		ds      directives.Dispatcher
+		playErr error
+		t       turn
+		player  = opts.Player
+	)
+
+	if player == nil {
+		player = NewPortAudioPlayer(opts.OutputDevice)
+	}
+
+	ds.Report = func(ev avs.Event) {
+		c.Send(ctx, ev, nil)
+	}
+
+	ds.Handle("SpeechSynthesizer", "Speak", func(d directives.Directive) error {
+		if playErr != nil || t.barged != nil {
+			return nil
+		}
+
+		t.barged, playErr = play(player, bytes.NewReader(d.(*directives.Speak).Audio), opts)
+		return playErr
+	})
+
+	if opts.AudioPlayer != nil {
+		opts.AudioPlayer.Handle(&ds)
+	}
+
+	if opts.Alerts != nil {
+		opts.Alerts.Handle(&ds)
+	}
+
+	// Answers are listened for once everything before has been said.
+	ds.Handle("SpeechRecognizer", "ExpectSpeech", func(d directives.Directive) error {
+		if playErr == nil && t.barged == nil {
+			t.expect = d.(*directives.ExpectSpeech)
+		}
+
+		return nil
+	})
+
+	ds.DispatchResponse(resp.Response)
+
+	return t, playErr
+}
+
+// play plays audio, watching for the user barging in on it if
+// opts.BargeIn is set.
+func play(player Player, audio io.Reader, opts ListenOpts) ([]int16, error) {
+	if opts.BargeIn == nil {
+		return nil, player.Play(audio)
+	}
+
+	var (
+		stop     = make(chan struct{})
+		done     = make(chan struct{})
+		barged   []int16
+		watchErr error
+	)
+
+	// The user can barge in before player gets going.
+	if c, ok := player.(cuePlayer); ok {
+		c.Cue()
+	}
+
+	go func() {
+		defer close(done)
+
+		barged, watchErr = opts.BargeIn.watch(opts.Source, player, stop)
+		if barged != nil {
+			player.Stop()
+		}
+	}()
+
+	err := player.Play(audio)
+
+	close(stop)
+	<-done
+
+	if err == nil && watchErr != nil && watchErr != io.EOF && watchErr != io.ErrUnexpectedEOF {
+		err = watchErr
+	}
+
+	return barged, err
 }
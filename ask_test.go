@@ -0,0 +1,334 @@
+package alexa
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/avs"
+	"github.com/Fruchtgummi/alexa/avs/avstest"
+)
+
+// testClient returns a Client talking to s, as the device would.
+func testClient(t *testing.T, s *avstest.Server) *Client {
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	c := (&GlobalOptions{Endpoint: ts.URL}).Client()
+	c.Tokens = TokenFunc(func() (string, error) { return "token", nil })
+
+	return c
+}
+
+// fakePlayer takes Duration over playing anything, or until stopped,
+// and sounds as loud as Loudness.
+type fakePlayer struct {
+	Duration time.Duration
+	Loudness float64
+
+	lock  sync.Mutex
+	stop  chan struct{}
+	plays int
+	stops int
+}
+
+func (p *fakePlayer) Play(r io.Reader) error {
+	p.lock.Lock()
+	p.plays++
+	if p.stop == nil {
+		p.stop = make(chan struct{})
+	}
+	stop := p.stop
+	p.lock.Unlock()
+
+	io.Copy(ioutil.Discard, r)
+
+	select {
+	case <-stop:
+	case <-time.After(p.Duration):
+	}
+
+	p.lock.Lock()
+	p.stop = nil
+	p.lock.Unlock()
+
+	return nil
+}
+
+// Stop stops what's playing, or what's about to be, like a barge-in
+// that comes before the player has got going.
+func (p *fakePlayer) Stop() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.stops++
+
+	if p.stop == nil {
+		p.stop = make(chan struct{})
+	}
+
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+
+	return nil
+}
+
+func (p *fakePlayer) Pause() error            { return nil }
+func (p *fakePlayer) Resume() error           { return nil }
+func (p *fakePlayer) Position() time.Duration { return 0 }
+func (p *fakePlayer) Level() float64          { return p.Loudness }
+
+func (p *fakePlayer) counts() (plays, stops int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.plays, p.stops
+}
+
+// heldSource is src, held up after its first hold samples until
+// release is closed.
+type heldSource struct {
+	AudioSource
+	hold    int
+	release chan struct{}
+	held    bool
+}
+
+func (s *heldSource) Read(buf []int16) (int, error) {
+	if s.hold <= 0 && !s.held {
+		s.held = true
+
+		select {
+		case <-s.release:
+		case <-time.After(5 * time.Second):
+		}
+	}
+
+	if s.hold > 0 && len(buf) > s.hold {
+		buf = buf[:s.hold]
+	}
+
+	n, err := s.AudioSource.Read(buf)
+	s.hold -= n
+
+	return n, err
+}
+
+// countingBody counts the bytes read from it.
+type countingBody struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (b countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(b.n, int64(n))
+
+	return n, err
+}
+
+func TestListenStreams(t *testing.T) {
+	var (
+		received int64
+		s        = &avstest.Server{Speech: []byte("answer")}
+		release  = make(chan struct{})
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.Body = countingBody{req.Body, &received}
+		s.ServeHTTP(w, req)
+	}))
+	defer ts.Close()
+
+	c := NewClient(TokenFunc(func() (string, error) { return "token", nil }))
+	c.Endpoint = ts.URL
+	c.Locale = ""
+
+	// A second of speech, then the capture is held up until the server
+	// has had a good part of it; only a streaming upload gets there.
+	src := &heldSource{
+		AudioSource: NewGeneratorSource(16000,
+			Noise(0.002, 500*time.Millisecond),
+			Voice(150, 0.3, time.Second),
+			Noise(0.002, 2*time.Second),
+		),
+		hold:    24000,
+		release: release,
+	}
+
+	go func() {
+		deadline := time.Now().Add(5 * time.Second)
+
+		for atomic.LoadInt64(&received) < 16000 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		close(release)
+	}()
+
+	start := time.Now()
+
+	err := Listen(context.Background(), c, ListenOpts{
+		Source:   src,
+		Detector: NewEnergyDetector(),
+		Player:   &fakePlayer{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := time.Since(start); d > 4*time.Second {
+		t.Errorf("capture was held up for %s; the audio wasn't sent until it ended", d)
+	}
+
+	reqs := s.Requests()
+	if len(reqs) != 1 || len(reqs[0].Audio) < 32000 {
+		t.Fatalf("server got %d requests, want one Recognize with the utterance", len(reqs))
+	}
+}
+
+func TestListenNoSpeech(t *testing.T) {
+	s := &avstest.Server{Speech: []byte("answer")}
+
+	err := Listen(context.Background(), testClient(t, s), ListenOpts{
+		Source:            NewGeneratorSource(16000, Noise(0.002, 10*time.Second)),
+		Detector:          NewEnergyDetector(),
+		MaxInitialSilence: time.Second,
+		Player:            &fakePlayer{},
+	})
+	if err != ErrNoSpeech {
+		t.Fatalf("got %v, want ErrNoSpeech", err)
+	}
+}
+
+// askingServer asks which city after the first question, saying to
+// wait timeout ms for the answer.
+func askingServer(timeout int) *avstest.Server {
+	var (
+		s         = &avstest.Server{}
+		questions int32
+	)
+
+	s.Respond = func(r *avstest.Request) *avstest.Reply {
+		ev := r.Message.Event
+		if ev.Header.Name != "Recognize" {
+			return nil
+		}
+
+		reply := avstest.Speak(ev.Header.DialogRequestId, []byte("answer"))
+
+		if atomic.AddInt32(&questions, 1) == 1 {
+			reply.Directives = append(reply.Directives, avstest.Directive("SpeechRecognizer", "ExpectSpeech", ev.Header.DialogRequestId, map[string]interface{}{
+				"timeoutInMilliseconds": timeout,
+				"initiator":             map[string]string{"token": "which-city"},
+			}))
+		}
+
+		return reply
+	}
+
+	return s
+}
+
+// countedSource counts the samples read from it.
+type countedSource struct {
+	AudioSource
+	n int
+}
+
+func (s *countedSource) Read(buf []int16) (int, error) {
+	n, err := s.AudioSource.Read(buf)
+	s.n += n
+
+	return n, err
+}
+
+// converseWith asks a question out of segments of a server that asks
+// back, and returns what it was sent after the question and how much
+// of the audio was listened to.
+func converseWith(t *testing.T, s *avstest.Server, segments ...Segment) ([]*avstest.Request, time.Duration) {
+	src := &countedSource{AudioSource: NewGeneratorSource(16000, segments...)}
+
+	err := Listen(context.Background(), testClient(t, s), ListenOpts{
+		Source:   src,
+		Detector: NewEnergyDetector(),
+		Player:   &fakePlayer{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dialog []*avstest.Request
+	for _, r := range s.Requests() {
+		if r.Message.Event.Header.Namespace == "SpeechRecognizer" {
+			dialog = append(dialog, r)
+		}
+	}
+
+	if len(dialog) == 0 || dialog[0].Message.Event.Header.Name != "Recognize" {
+		t.Fatal("the question was never asked")
+	}
+
+	return dialog[1:], time.Duration(src.n) * time.Second / 16000
+}
+
+func TestExpectSpeechAnswered(t *testing.T) {
+	after, _ := converseWith(t, askingServer(2000),
+		Noise(0.002, time.Second),
+		Voice(150, 0.3, time.Second),
+		Noise(0.002, 3*time.Second),
+		Voice(180, 0.3, time.Second),
+		Noise(0.002, 3*time.Second),
+	)
+
+	if len(after) != 1 || after[0].Message.Event.Header.Name != "Recognize" {
+		t.Fatalf("got %d events after the question, want a Recognize with the answer", len(after))
+	}
+
+	var p avs.RecognizePayload
+
+	raw, _ := json.Marshal(after[0].Message.Event.Payload)
+	json.Unmarshal(raw, &p)
+
+	if string(p.Initiator) != `{"token":"which-city"}` {
+		t.Errorf("answer went with initiator %s, want the one from ExpectSpeech", p.Initiator)
+	}
+}
+
+func TestExpectSpeechTimesOut(t *testing.T) {
+	question := []Segment{
+		Noise(0.002, time.Second),
+		Voice(150, 0.3, time.Second),
+		Noise(0.002, 30*time.Second),
+	}
+
+	// The question has ended by about 3s, after the quiet that ends
+	// it; the answer is waited for from there.
+	for _, c := range []struct {
+		timeout int
+		waited  time.Duration
+	}{
+		{2000, 2 * time.Second},
+		{0, DefaultExpectSpeechTimeout},
+	} {
+		after, heard := converseWith(t, askingServer(c.timeout), question...)
+
+		if len(after) != 1 || after[0].Message.Event.Header.Name != "ExpectSpeechTimedOut" {
+			t.Errorf("timeout %dms: got %d events after the question, want ExpectSpeechTimedOut", c.timeout, len(after))
+		}
+
+		if heard < 2*time.Second+c.waited || heard > 4*time.Second+c.waited {
+			t.Errorf("timeout %dms: listened to %v of audio, want the answer waited for for %v", c.timeout, heard, c.waited)
+		}
+	}
+}
@@ -2,11 +2,16 @@ package alexa
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/Fruchtgummi/alexa/config"
 	"github.com/Fruchtgummi/alexa/portaudio"
 )
 
 type AudioCommand struct {
+	InputDevice  string `long:"input-device" description:"make this device (index, name or part of a name) the default for input"`
+	OutputDevice string `long:"output-device" description:"make this device (index, name or part of a name) the default for output"`
 }
 
 func (a *AudioCommand) Execute(args []string) error {
@@ -15,14 +20,107 @@ func (a *AudioCommand) Execute(args []string) error {
 		return err
 	}
 
+	defer portaudio.Terminate()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if a.InputDevice != "" || a.OutputDevice != "" {
+		err = a.save(cfg)
+		if err != nil {
+			return err
+		}
+	}
+
 	devices, err := portaudio.Devices()
 	if err != nil {
 		return err
 	}
 
-	for _, device := range devices {
-		fmt.Printf("%s: input=%d output=%d\n", device.Name, device.MaxInputChannels, device.MaxOutputChannels)
+	// Errors just mean there's no such device to mark.
+	defIn, _ := portaudio.DefaultInputDevice()
+	defOut, _ := portaudio.DefaultOutputDevice()
+	cfgIn, _ := FindDevice(cfg.InputDevice, true)
+	cfgOut, _ := FindDevice(cfg.OutputDevice, false)
+
+	for i, device := range devices {
+		var marks []string
+
+		if device == cfgIn {
+			marks = append(marks, "input")
+		}
+
+		if device == cfgOut {
+			marks = append(marks, "output")
+		}
+
+		if device == defIn {
+			marks = append(marks, "system input")
+		}
+
+		if device == defOut {
+			marks = append(marks, "system output")
+		}
+
+		mark := ""
+		if len(marks) > 0 {
+			mark = " [" + strings.Join(marks, ", ") + "]"
+		}
+
+		fmt.Printf("%d: %s: input=%d output=%d%s\n", i, device.Name, device.MaxInputChannels, device.MaxOutputChannels, mark)
+		fmt.Printf("   host api: %s, default rate: %.0fHz\n", device.HostApi.Name, device.DefaultSampleRate)
+
+		if device.MaxInputChannels > 0 {
+			fmt.Printf("   input latency: %s low, %s high, rates: %s\n",
+				ms(device.DefaultLowInputLatency), ms(device.DefaultHighInputLatency), rates(supportedRates(device, true)))
+		}
+
+		if device.MaxOutputChannels > 0 {
+			fmt.Printf("   output latency: %s low, %s high, rates: %s\n",
+				ms(device.DefaultLowOutputLatency), ms(device.DefaultHighOutputLatency), rates(supportedRates(device, false)))
+		}
 	}
 
 	return nil
 }
+
+func (a *AudioCommand) save(cfg *config.Config) error {
+	if a.InputDevice != "" {
+		dev, err := FindDevice(a.InputDevice, true)
+		if err != nil {
+			return err
+		}
+
+		cfg.InputDevice = dev.Name
+	}
+
+	if a.OutputDevice != "" {
+		dev, err := FindDevice(a.OutputDevice, false)
+		if err != nil {
+			return err
+		}
+
+		cfg.OutputDevice = dev.Name
+	}
+
+	return config.WriteConfig(cfg)
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", d.Seconds()*1000)
+}
+
+func rates(r []float64) string {
+	if len(r) == 0 {
+		return "none"
+	}
+
+	var s []string
+	for _, rate := range r {
+		s = append(s, fmt.Sprintf("%.0f", rate))
+	}
+
+	return strings.Join(s, " ")
+}
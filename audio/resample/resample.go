@@ -0,0 +1,187 @@
+// Package resample changes the sample rate of a stream of audio with a
+// Kaiser windowed sinc filter, evaluated from a precomputed table so
+// any ratio between the two rates works.
+package resample
+
+import "math"
+
+const (
+	// zeroCrossings is how many zero crossings of the sinc are kept on
+	// each side. More means a steeper filter and more work per sample.
+	zeroCrossings = 24
+
+	// rolloff puts the cutoff a little below the lower Nyquist rate so
+	// the transition band doesn't alias.
+	rolloff = 0.92
+
+	// beta of the Kaiser window; 8.6 keeps the stopband about 90dB
+	// down.
+	beta = 8.6
+
+	// tableDensity is the number of table entries per input sample.
+	tableDensity = 512
+)
+
+// Resampler converts mono audio from one rate to another. It keeps the
+// tail of what it was given so that it can be fed in chunks of any
+// size.
+type Resampler struct {
+	step      float64
+	cutoff    float64
+	halfWidth float64
+	table     []float64
+
+	buf  []float64
+	base int64
+	t    float64
+	in   int64
+}
+
+// New returns a Resampler from one rate in Hz to another.
+func New(from, to float64) *Resampler {
+	cutoff := math.Min(1, to/from) * rolloff
+	halfWidth := zeroCrossings / cutoff
+
+	r := &Resampler{
+		step:      from / to,
+		cutoff:    cutoff,
+		halfWidth: halfWidth,
+		table:     make([]float64, int(halfWidth*tableDensity)+2),
+	}
+
+	i0b := bessel0(beta)
+
+	for i := range r.table {
+		x := float64(i) / tableDensity
+		if x > halfWidth {
+			continue
+		}
+
+		w := x / halfWidth
+		r.table[i] = cutoff * sinc(cutoff*x) * bessel0(beta*math.Sqrt(1-w*w)) / i0b
+	}
+
+	// Start with a half filter's worth of silence, so the first output
+	// sample lines up with the first input sample.
+	pad := int(math.Ceil(halfWidth))
+	r.buf = make([]float64, pad)
+	r.base = -int64(pad)
+
+	return r
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// bessel0 is the zeroth order modified Bessel function of the first
+// kind, which the Kaiser window is made of.
+func bessel0(x float64) float64 {
+	sum, term := 1.0, 1.0
+
+	for k := 1; k < 50; k++ {
+		term *= (x / 2) / float64(k)
+		sum += term * term
+
+		if term*term < sum*1e-16 {
+			break
+		}
+	}
+
+	return sum
+}
+
+func (r *Resampler) kernel(x float64) float64 {
+	x = math.Abs(x) * tableDensity
+
+	i := int(x)
+	if i+1 >= len(r.table) {
+		return 0
+	}
+
+	f := x - float64(i)
+
+	return r.table[i] + (r.table[i+1]-r.table[i])*f
+}
+
+// Process feeds in src and appends to dst every output sample that can
+// now be computed.
+func (r *Resampler) Process(dst, src []float64) []float64 {
+	r.in += int64(len(src))
+
+	return r.process(dst, src, math.Inf(1))
+}
+
+// process appends src and computes output up to, but not including,
+// input time limit.
+func (r *Resampler) process(dst, src []float64, limit float64) []float64 {
+	r.buf = append(r.buf, src...)
+
+	end := r.base + int64(len(r.buf))
+
+	for r.t+r.halfWidth < float64(end) && r.t < limit {
+		dst = append(dst, r.sample())
+		r.t += r.step
+	}
+
+	// Drop what no later output sample can reach.
+	keep := int64(math.Floor(r.t-r.halfWidth)) - r.base
+	if keep > 0 {
+		if keep > int64(len(r.buf)) {
+			keep = int64(len(r.buf))
+		}
+
+		n := copy(r.buf, r.buf[keep:])
+		r.buf = r.buf[:n]
+		r.base += keep
+	}
+
+	return dst
+}
+
+func (r *Resampler) sample() float64 {
+	lo := int64(math.Ceil(r.t-r.halfWidth)) - r.base
+	hi := int64(math.Floor(r.t+r.halfWidth)) - r.base
+
+	if lo < 0 {
+		lo = 0
+	}
+
+	if hi >= int64(len(r.buf)) {
+		hi = int64(len(r.buf)) - 1
+	}
+
+	var sum float64
+
+	for k := lo; k <= hi; k++ {
+		sum += r.buf[k] * r.kernel(r.t-float64(r.base+k))
+	}
+
+	return sum
+}
+
+// Flush appends the output still held back waiting for input that
+// will now never come.
+func (r *Resampler) Flush(dst []float64) []float64 {
+	return r.process(dst, make([]float64, int(math.Ceil(r.halfWidth))+1), float64(r.in))
+}
+
+// Downmix appends the average of each interleaved frame's channels to
+// dst.
+func Downmix(dst, frames []float64, channels int) []float64 {
+	for i := 0; i+channels <= len(frames); i += channels {
+		var sum float64
+
+		for _, v := range frames[i : i+channels] {
+			sum += v
+		}
+
+		dst = append(dst, sum/float64(channels))
+	}
+
+	return dst
+}
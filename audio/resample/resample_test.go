@@ -0,0 +1,138 @@
+package resample
+
+import (
+	"math"
+	"testing"
+)
+
+// The rates the microphone is resampled from, and one to upsample.
+var rates = []struct{ from, to float64 }{
+	{48000, 16000},
+	{44100, 16000},
+	{22050, 16000},
+	{8000, 16000},
+}
+
+const (
+	// maxRipple is how far the passband, up to passband of the lower
+	// Nyquist rate, may stray from unity gain, in dB.
+	maxRipple = 0.1
+	passband  = 0.8
+
+	// maxAlias is how loud a tone above the output's Nyquist rate may
+	// come out, and maxImage the images of upsampling, in dB.
+	maxAlias = -80.0
+	maxImage = -70.0
+)
+
+// resample runs a quarter of a second of a tone at f through a
+// Resampler, in odd sized chunks, and returns the middle of the
+// output, away from the edges.
+func resample(from, to, f float64) []float64 {
+	in := make([]float64, int(from)/4)
+	for i := range in {
+		in[i] = 0.5 * math.Sin(2*math.Pi*f*float64(i)/from)
+	}
+
+	var (
+		r   = New(from, to)
+		out []float64
+	)
+
+	for i := 0; i < len(in); i += 441 {
+		end := i + 441
+		if end > len(in) {
+			end = len(in)
+		}
+
+		out = r.Process(out, in[i:end])
+	}
+
+	out = r.Flush(out)
+	out = out[len(out)/4 : 3*len(out)/4]
+
+	// Whole periods only, so they measure what they should.
+	periods := math.Floor(float64(len(out)) * f / to)
+
+	return out[:int(periods*to/f)]
+}
+
+// gain is how much louder than the input tone out is, in dB.
+func gain(out []float64) float64 {
+	var sum float64
+	for _, v := range out {
+		sum += v * v
+	}
+
+	return 20 * math.Log10(math.Sqrt(sum/float64(len(out)))/(0.5/math.Sqrt2))
+}
+
+// level is how loud the component of out at f is, relative to the
+// input tone, in dB. A Hann window keeps the tone itself from leaking
+// into it.
+func level(out []float64, f, rate float64) float64 {
+	var re, im float64
+
+	for i, v := range out {
+		v *= 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(len(out)))
+
+		phase := 2 * math.Pi * f * float64(i) / rate
+		re += v * math.Cos(phase)
+		im += v * math.Sin(phase)
+	}
+
+	amplitude := 4 * math.Hypot(re, im) / float64(len(out))
+
+	return 20 * math.Log10(amplitude/0.5)
+}
+
+func TestPassbandRipple(t *testing.T) {
+	for _, r := range rates {
+		nyquist := math.Min(r.from, r.to) / 2
+
+		for f := 50.0; f < passband*nyquist; f *= 1.15 {
+			if g := gain(resample(r.from, r.to, f)); math.Abs(g) > maxRipple {
+				t.Errorf("%g to %g: %.0fHz comes out at %+.3fdB, want within %gdB", r.from, r.to, f, g, maxRipple)
+			}
+		}
+	}
+}
+
+func TestAliasing(t *testing.T) {
+	for _, r := range rates {
+		if r.to > r.from {
+			continue
+		}
+
+		for f := r.to / 2; f < r.from/2; f *= 1.1 {
+			if g := gain(resample(r.from, r.to, f)); g > maxAlias {
+				t.Errorf("%g to %g: %.0fHz aliases at %.1fdB, want below %gdB", r.from, r.to, f, g, maxAlias)
+			}
+		}
+	}
+}
+
+func TestImages(t *testing.T) {
+	for _, r := range rates {
+		if r.to <= r.from {
+			continue
+		}
+
+		for f := 50.0; f < passband*r.from/2; f *= 1.15 {
+			if g := level(resample(r.from, r.to, f), r.from-f, r.to); g > maxImage {
+				t.Errorf("%g to %g: %.0fHz has an image at %.1fdB, want below %gdB", r.from, r.to, f, g, maxImage)
+			}
+		}
+	}
+}
+
+func TestLength(t *testing.T) {
+	for _, r := range rates {
+		res := New(r.from, r.to)
+		out := res.Flush(res.Process(nil, make([]float64, int(r.from))))
+
+		if d := len(out) - int(r.to); d < -1 || d > 1 {
+			t.Errorf("%g to %g: a second came out as %d samples", r.from, r.to, len(out))
+		}
+	}
+}
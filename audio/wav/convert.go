@@ -0,0 +1,109 @@
+package wav
+
+import (
+	"io"
+
+	"github.com/Fruchtgummi/alexa/audio/resample"
+)
+
+// Converter turns the samples of a Reader into L16: 16kHz mono int16.
+// Channels are averaged together and the rate is changed with a
+// windowed sinc resampler.
+type Converter struct {
+	r  *Reader
+	rs *resample.Resampler
+
+	frames []float64
+	mono   []float64
+	out    []float64
+	next   int
+	err    error
+}
+
+func NewConverter(r *Reader) *Converter {
+	c := &Converter{r: r}
+
+	if r.Format.SampleRate != L16.SampleRate {
+		c.rs = resample.New(float64(r.Format.SampleRate), float64(L16.SampleRate))
+	}
+
+	return c
+}
+
+func (c *Converter) SampleRate() int { return L16.SampleRate }
+func (c *Converter) Channels() int   { return L16.Channels }
+
+// fill converts the next block of the file into c.out.
+func (c *Converter) fill() {
+	if c.frames == nil {
+		c.frames = make([]float64, 1024*c.r.Format.Channels)
+	}
+
+	n, err := c.r.ReadFloat(c.frames)
+	if err == nil && n == 0 {
+		err = io.EOF
+	}
+
+	c.mono = resample.Downmix(c.mono[:0], c.frames[:n], c.r.Format.Channels)
+	c.out = c.out[:0]
+	c.next = 0
+
+	if c.rs == nil {
+		c.out = append(c.out, c.mono...)
+	} else {
+		c.out = c.rs.Process(c.out, c.mono)
+
+		if err != nil {
+			c.out = c.rs.Flush(c.out)
+		}
+	}
+
+	c.err = err
+}
+
+// Read fills buf with converted samples.
+func (c *Converter) Read(buf []int16) (int, error) {
+	var n int
+
+	for n < len(buf) {
+		if c.next == len(c.out) {
+			if c.err != nil {
+				break
+			}
+
+			c.fill()
+			continue
+		}
+
+		buf[n] = ToInt16(c.out[c.next])
+		c.next++
+		n++
+	}
+
+	if n == 0 {
+		return 0, c.err
+	}
+
+	return n, nil
+}
+
+// ReadL16 reads all of r, converted to L16.
+func ReadL16(r *Reader) ([]int16, error) {
+	var (
+		c   = NewConverter(r)
+		out []int16
+		buf = make([]int16, 4096)
+	)
+
+	for {
+		n, err := c.Read(buf)
+		out = append(out, buf[:n]...)
+
+		if err != nil {
+			if err == io.EOF {
+				return out, nil
+			}
+			return out, err
+		}
+	}
+}
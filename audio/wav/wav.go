@@ -0,0 +1,472 @@
+// Package wav reads and writes PCM WAV files: 8, 16, 24 and 32 bit
+// integer and 32 bit float samples, any number of channels, any rate.
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+const (
+	formatPCM        = 1
+	formatFloat      = 3
+	formatExtensible = 0xfffe
+)
+
+type Format struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+
+	// Float means 32 bit IEEE float samples rather than integers.
+	Float bool
+}
+
+// L16 is the format AVS wants audio in.
+var L16 = Format{SampleRate: 16000, Channels: 1, BitsPerSample: 16}
+
+func (f Format) bytesPerSample() int {
+	return f.BitsPerSample / 8
+}
+
+// BlockAlign is the size of one frame, a sample for every channel.
+func (f Format) BlockAlign() int {
+	return f.Channels * f.bytesPerSample()
+}
+
+func (f Format) check() error {
+	if f.Channels < 1 || f.SampleRate < 1 {
+		return fmt.Errorf("wav: bad format %+v", f)
+	}
+
+	switch {
+	case f.Float && f.BitsPerSample == 32:
+	case !f.Float && (f.BitsPerSample == 8 || f.BitsPerSample == 16 || f.BitsPerSample == 24 || f.BitsPerSample == 32):
+	default:
+		return fmt.Errorf("wav: unsupported sample format %+v", f)
+	}
+
+	return nil
+}
+
+var ErrNotWAV = errors.New("wav: not a RIFF/WAVE file")
+
+// Reader reads the samples of a WAV file.
+type Reader struct {
+	Format Format
+
+	r      io.Reader
+	closer io.Closer
+	left   int64
+	bytes  []byte
+	floats []float64
+}
+
+// NewReader reads the headers from r, leaving it at the start of the
+// samples.
+func NewReader(r io.Reader) (*Reader, error) {
+	var riff [12]byte
+
+	_, err := io.ReadFull(r, riff[:])
+	if err != nil {
+		return nil, err
+	}
+
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, ErrNotWAV
+	}
+
+	var (
+		rd      Reader
+		haveFmt bool
+		chunk   [8]byte
+	)
+
+	for {
+		_, err = io.ReadFull(r, chunk[:])
+		if err != nil {
+			return nil, err
+		}
+
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch string(chunk[:4]) {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("wav: fmt chunk too short")
+			}
+
+			data := make([]byte, size)
+
+			_, err = io.ReadFull(r, data)
+			if err != nil {
+				return nil, err
+			}
+
+			rd.Format, err = parseFormat(data)
+			if err != nil {
+				return nil, err
+			}
+
+			haveFmt = true
+
+			if size&1 == 1 {
+				_, err = io.CopyN(ioutil.Discard, r, 1)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			continue
+		case "data":
+			if !haveFmt {
+				return nil, fmt.Errorf("wav: data before fmt chunk")
+			}
+
+			rd.r = r
+			rd.left = size
+
+			// Streaming writers leave the size at 0 or all ones when
+			// they couldn't go back and fix it.
+			if size == 0 || size == 0xffffffff {
+				rd.left = -1
+			}
+
+			return &rd, nil
+		}
+
+		_, err = io.CopyN(ioutil.Discard, r, size+size&1)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func parseFormat(data []byte) (Format, error) {
+	tag := binary.LittleEndian.Uint16(data[0:])
+
+	f := Format{
+		Channels:      int(binary.LittleEndian.Uint16(data[2:])),
+		SampleRate:    int(binary.LittleEndian.Uint32(data[4:])),
+		BitsPerSample: int(binary.LittleEndian.Uint16(data[14:])),
+	}
+
+	if tag == formatExtensible && len(data) >= 26 {
+		// The real format tag is the start of the sub format GUID.
+		tag = binary.LittleEndian.Uint16(data[24:])
+	}
+
+	switch tag {
+	case formatPCM:
+	case formatFloat:
+		f.Float = true
+	default:
+		return f, fmt.Errorf("wav: unsupported format tag %#x", tag)
+	}
+
+	return f, f.check()
+}
+
+// Open opens a WAV file. Closing the Reader closes the file.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	r.closer = f
+
+	return r, nil
+}
+
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+
+	return nil
+}
+
+// Frames returns how many frames are left to read, or -1 if the
+// header doesn't say.
+func (r *Reader) Frames() int64 {
+	if r.left < 0 {
+		return -1
+	}
+
+	return r.left / int64(r.Format.BlockAlign())
+}
+
+// ReadFloat fills buf with interleaved samples scaled to -1..1 and
+// returns how many it read, always a whole number of frames.
+func (r *Reader) ReadFloat(buf []float64) (int, error) {
+	bps := r.Format.bytesPerSample()
+
+	n := len(buf) - len(buf)%r.Format.Channels
+	if n == 0 {
+		return 0, nil
+	}
+
+	want := int64(n * bps)
+	if r.left >= 0 && want > r.left {
+		want = r.left - r.left%int64(r.Format.BlockAlign())
+	}
+
+	if want == 0 {
+		return 0, io.EOF
+	}
+
+	if int64(cap(r.bytes)) < want {
+		r.bytes = make([]byte, want)
+	}
+
+	b := r.bytes[:want]
+
+	got, err := io.ReadFull(r.r, b)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+
+	got -= got % r.Format.BlockAlign()
+
+	if r.left >= 0 {
+		r.left -= int64(got)
+	}
+
+	n = got / bps
+
+	for i := 0; i < n; i++ {
+		buf[i] = decode(r.Format, b[i*bps:])
+	}
+
+	if n == 0 && err == nil {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// ReadInt16 is ReadFloat for int16 samples.
+func (r *Reader) ReadInt16(buf []int16) (int, error) {
+	if cap(r.floats) < len(buf) {
+		r.floats = make([]float64, len(buf))
+	}
+
+	tmp := r.floats[:len(buf)]
+
+	n, err := r.ReadFloat(tmp)
+
+	for i := 0; i < n; i++ {
+		buf[i] = ToInt16(tmp[i])
+	}
+
+	return n, err
+}
+
+func decode(f Format, b []byte) float64 {
+	switch {
+	case f.Float:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case f.BitsPerSample == 8:
+		// 8 bit WAV is unsigned.
+		return (float64(b[0]) - 128) / 128
+	case f.BitsPerSample == 16:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case f.BitsPerSample == 24:
+		v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		return float64(v) / (1 << 23)
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
+
+func encode(f Format, b []byte, v float64) {
+	if v > 1 {
+		v = 1
+	} else if v < -1 {
+		v = -1
+	}
+
+	switch {
+	case f.Float:
+		binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v)))
+	case f.BitsPerSample == 8:
+		b[0] = uint8(clamp(math.Round(v*128)+128, 0, 255))
+	case f.BitsPerSample == 16:
+		binary.LittleEndian.PutUint16(b, uint16(ToInt16(v)))
+	case f.BitsPerSample == 24:
+		s := int32(clamp(math.Round(v*(1<<23)), -(1 << 23), 1<<23-1))
+		b[0], b[1], b[2] = byte(s), byte(s>>8), byte(s>>16)
+	default:
+		s := int32(clamp(math.Round(v*(1<<31)), -(1 << 31), 1<<31-1))
+		binary.LittleEndian.PutUint32(b, uint32(s))
+	}
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+// ToInt16 scales a -1..1 sample to int16, clipping anything outside.
+func ToInt16(v float64) int16 {
+	return int16(clamp(math.Round(v*(1<<15)), math.MinInt16, math.MaxInt16))
+}
+
+// Writer writes a WAV file as it goes, going back to fill in the sizes
+// in the header on Close.
+type Writer struct {
+	Format Format
+
+	w      io.WriteSeeker
+	closer io.Closer
+	size   int64
+	bytes  []byte
+	floats []float64
+}
+
+const headerSize = 44
+
+// NewWriter writes a header for f to w. The sizes in it are patched
+// when the Writer is closed.
+func NewWriter(w io.WriteSeeker, f Format) (*Writer, error) {
+	err := f.check()
+	if err != nil {
+		return nil, err
+	}
+
+	wr := &Writer{Format: f, w: w}
+
+	_, err = w.Write(wr.header())
+	if err != nil {
+		return nil, err
+	}
+
+	return wr, nil
+}
+
+// Create creates a WAV file at path. Closing the Writer closes the
+// file.
+func Create(path string, f Format) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := NewWriter(file, f)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	w.closer = file
+
+	return w, nil
+}
+
+func (w *Writer) header() []byte {
+	h := make([]byte, headerSize)
+
+	tag := uint16(formatPCM)
+	if w.Format.Float {
+		tag = formatFloat
+	}
+
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], uint32(headerSize-8+w.size+w.size&1))
+	copy(h[8:], "WAVE")
+	copy(h[12:], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], tag)
+	binary.LittleEndian.PutUint16(h[22:], uint16(w.Format.Channels))
+	binary.LittleEndian.PutUint32(h[24:], uint32(w.Format.SampleRate))
+	binary.LittleEndian.PutUint32(h[28:], uint32(w.Format.SampleRate*w.Format.BlockAlign()))
+	binary.LittleEndian.PutUint16(h[32:], uint16(w.Format.BlockAlign()))
+	binary.LittleEndian.PutUint16(h[34:], uint16(w.Format.BitsPerSample))
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], uint32(w.size))
+
+	return h
+}
+
+// WriteFloat writes interleaved samples in the range -1..1.
+func (w *Writer) WriteFloat(samples []float64) error {
+	bps := w.Format.bytesPerSample()
+
+	if cap(w.bytes) < len(samples)*bps {
+		w.bytes = make([]byte, len(samples)*bps)
+	}
+
+	b := w.bytes[:len(samples)*bps]
+
+	for i, v := range samples {
+		encode(w.Format, b[i*bps:], v)
+	}
+
+	n, err := w.w.Write(b)
+	w.size += int64(n)
+
+	return err
+}
+
+// WriteInt16 writes interleaved int16 samples.
+func (w *Writer) WriteInt16(samples []int16) error {
+	if cap(w.floats) < len(samples) {
+		w.floats = make([]float64, len(samples))
+	}
+
+	tmp := w.floats[:len(samples)]
+
+	for i, s := range samples {
+		tmp[i] = float64(s) / (1 << 15)
+	}
+
+	return w.WriteFloat(tmp)
+}
+
+// Close pads the data chunk to an even size and fixes up the sizes in
+// the header.
+func (w *Writer) Close() error {
+	err := w.finish()
+
+	if w.closer != nil {
+		cerr := w.closer.Close()
+		if err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+func (w *Writer) finish() error {
+	if w.size&1 == 1 {
+		_, err := w.w.Write([]byte{0})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := w.w.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.w.Write(w.header())
+	if err != nil {
+		return err
+	}
+
+	_, err = w.w.Seek(0, io.SeekEnd)
+	return err
+}
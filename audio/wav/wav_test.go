@@ -0,0 +1,281 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// memFile is an io.WriteSeeker in memory.
+type memFile struct {
+	buf []byte
+	pos int
+}
+
+func (m *memFile) Write(p []byte) (int, error) {
+	switch end := m.pos + len(p); {
+	case end <= len(m.buf):
+	case end <= cap(m.buf):
+		m.buf = m.buf[:end]
+	default:
+		m.buf = append(m.buf, make([]byte, end-len(m.buf))...)
+	}
+
+	copy(m.buf[m.pos:], p)
+	m.pos += len(p)
+
+	return len(p), nil
+}
+
+func (m *memFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		m.pos = int(offset)
+	case io.SeekCurrent:
+		m.pos += int(offset)
+	case io.SeekEnd:
+		m.pos = len(m.buf) + int(offset)
+	}
+
+	return int64(m.pos), nil
+}
+
+// sine is n frames of a 440Hz tone, a little quieter on the right.
+func sine(f Format, n int) []float64 {
+	out := make([]float64, n*f.Channels)
+
+	for i := 0; i < n; i++ {
+		for c := 0; c < f.Channels; c++ {
+			out[i*f.Channels+c] = 0.8 / float64(c+1) * math.Sin(2*math.Pi*440*float64(i)/float64(f.SampleRate))
+		}
+	}
+
+	return out
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, f := range []Format{
+		{SampleRate: 8000, Channels: 1, BitsPerSample: 8},
+		{SampleRate: 16000, Channels: 1, BitsPerSample: 16},
+		{SampleRate: 44100, Channels: 2, BitsPerSample: 24},
+		{SampleRate: 48000, Channels: 2, BitsPerSample: 32},
+		{SampleRate: 48000, Channels: 2, BitsPerSample: 32, Float: true},
+	} {
+		var (
+			file memFile
+			in   = sine(f, 1001)
+		)
+
+		w, err := NewWriter(&file, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = w.WriteFloat(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := NewReader(bytes.NewReader(file.buf))
+		if err != nil {
+			t.Fatalf("%+v: %s", f, err)
+		}
+
+		if r.Format != f {
+			t.Errorf("wrote %+v, read back %+v", f, r.Format)
+		}
+
+		if r.Frames() != 1001 {
+			t.Errorf("%+v: %d frames, want 1001", f, r.Frames())
+		}
+
+		out := make([]float64, len(in)+10)
+
+		n, err := r.ReadFloat(out)
+		if err != nil || n != len(in) {
+			t.Fatalf("%+v: read %d samples, %v, want %d", f, n, err, len(in))
+		}
+
+		// Half a step of the sample size, or what float32 keeps.
+		tolerance := 1 / math.Pow(2, float64(f.BitsPerSample))
+		if f.Float {
+			tolerance = 1e-7
+		}
+
+		for i := range in {
+			if math.Abs(out[i]-in[i]) > tolerance {
+				t.Fatalf("%+v: sample %d came back %g, want %g", f, i, out[i], in[i])
+			}
+		}
+
+		_, err = r.ReadFloat(out)
+		if err != io.EOF {
+			t.Errorf("%+v: got %v at the end, want io.EOF", f, err)
+		}
+	}
+}
+
+func TestInt16(t *testing.T) {
+	var (
+		file memFile
+		in   = []int16{0, 1, -1, 12345, math.MaxInt16, math.MinInt16}
+	)
+
+	w, err := NewWriter(&file, L16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.WriteInt16(in)
+	w.Close()
+
+	r, err := NewReader(bytes.NewReader(file.buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := make([]int16, len(in))
+
+	n, err := r.ReadInt16(out)
+	if err != nil || n != len(in) {
+		t.Fatalf("read %d samples, %v", n, err)
+	}
+
+	for i := range in {
+		if out[i] != in[i] {
+			t.Errorf("sample %d came back %d, want %d", i, out[i], in[i])
+		}
+	}
+}
+
+func TestCloseFixesSizes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "odd.wav")
+
+	w, err := Create(path, Format{SampleRate: 8000, Channels: 1, BitsPerSample: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.WriteFloat([]float64{0, 0.5, -0.5})
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Three bytes of data, padded to four.
+	if len(b) != headerSize+4 {
+		t.Fatalf("file is %d bytes, want %d", len(b), headerSize+4)
+	}
+
+	if riff := binary.LittleEndian.Uint32(b[4:]); riff != headerSize-8+4 {
+		t.Errorf("RIFF size %d, want %d", riff, headerSize-8+4)
+	}
+
+	if data := binary.LittleEndian.Uint32(b[40:]); data != 3 {
+		t.Errorf("data size %d, want 3", data)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	if r.Frames() != 3 {
+		t.Errorf("%d frames, want 3", r.Frames())
+	}
+}
+
+func TestConverter(t *testing.T) {
+	var (
+		file memFile
+		f    = Format{SampleRate: 48000, Channels: 2, BitsPerSample: 16}
+	)
+
+	w, err := NewWriter(&file, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.WriteFloat(sine(f, 48000))
+	w.Close()
+
+	r, err := NewReader(bytes.NewReader(file.buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ReadL16(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) < 15990 || len(out) > 16010 {
+		t.Errorf("a second at 48kHz came out as %d samples at 16kHz", len(out))
+	}
+
+	// The channels, at 0.8 and 0.4, average to 0.6 of full scale.
+	var peak int16
+	for _, s := range out[1000 : len(out)-1000] {
+		if s > peak {
+			peak = s
+		}
+	}
+
+	if want := int16(19661); peak < want-200 || peak > want+200 {
+		t.Errorf("peak %d, want about %d", peak, want)
+	}
+}
+
+func TestInt16DoesNotAllocate(t *testing.T) {
+	var (
+		file  = memFile{buf: make([]byte, 0, 1<<20)}
+		frame = make([]int16, 320)
+	)
+
+	w, err := NewWriter(&file, L16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testing.AllocsPerRun(50, func() { w.WriteInt16(frame) }); n != 0 {
+		t.Errorf("WriteInt16 made %g allocations a frame", n)
+	}
+
+	w.Close()
+
+	r, err := NewReader(bytes.NewReader(file.buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.ReadInt16(frame)
+
+	if n := testing.AllocsPerRun(50, func() { r.ReadInt16(frame) }); n != 0 {
+		t.Errorf("ReadInt16 made %g allocations a frame", n)
+	}
+}
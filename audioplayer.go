@@ -0,0 +1,587 @@
+package alexa
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/avs"
+	"github.com/Fruchtgummi/alexa/directives"
+)
+
+// What the AudioPlayer is doing, as AVS calls it.
+const (
+	ActivityIdle     = "IDLE"
+	ActivityPlaying  = "PLAYING"
+	ActivityPaused   = "PAUSED"
+	ActivityStopped  = "STOPPED"
+	ActivityFinished = "FINISHED"
+)
+
+// progressTick is how often playback is checked for progress reports
+// being due.
+const progressTick = 100 * time.Millisecond
+
+// AudioPlayer plays what AudioPlayer.Play directives ask for, music,
+// radio and podcasts, one item after the other, and tells AVS how it's
+// getting on.
+type AudioPlayer struct {
+	// Player plays the streams.
+	Player Player
+
+	// HTTPClient fetches streams and playlists. Nil means
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Report is given the events to send to AVS.
+	Report func(avs.Event)
+
+	// Focus, if set, is asked for the Content channel while playing.
+	Focus *FocusManager
+
+	lock     sync.Mutex
+	queue    []directives.Stream
+	current  *playing
+	token    string
+	offset   time.Duration
+	activity string
+	idle     chan struct{}
+	focus    focusFollower
+}
+
+// playing is the stream being played now.
+type playing struct {
+	stream  directives.Stream
+	start   time.Duration
+	cancel  context.CancelFunc
+	started bool
+	stopped bool
+	done    chan struct{}
+}
+
+func NewAudioPlayer(player Player, report func(avs.Event)) *AudioPlayer {
+	idle := make(chan struct{})
+	close(idle)
+
+	return &AudioPlayer{
+		Player:   player,
+		Report:   report,
+		activity: ActivityIdle,
+		idle:     idle,
+	}
+}
+
+// Handle registers the AudioPlayer's directives with ds.
+func (a *AudioPlayer) Handle(ds *directives.Dispatcher) {
+	ds.Handle("AudioPlayer", "Play", func(d directives.Directive) error {
+		a.Play(d.(*directives.Play))
+		return nil
+	})
+
+	ds.Handle("AudioPlayer", "Stop", func(d directives.Directive) error {
+		a.Stop()
+		return nil
+	})
+
+	ds.Handle("AudioPlayer", "ClearQueue", func(d directives.Directive) error {
+		a.ClearQueue(d.(*directives.ClearQueue).ClearBehavior)
+		return nil
+	})
+}
+
+// Play queues the item in d according to its playBehavior, and starts
+// playing if nothing is.
+func (a *AudioPlayer) Play(d *directives.Play) {
+	s := d.AudioItem.Stream
+
+	// What replaces it starts straight away, so Idle stays open.
+	if d.PlayBehavior == directives.ReplaceAll {
+		a.stop()
+	}
+
+	a.lock.Lock()
+
+	switch d.PlayBehavior {
+	case directives.ReplaceAll, directives.ReplaceEnqueued:
+		a.queue = nil
+	default:
+		// An item that follows on from something else no longer
+		// queued is stale.
+		if s.ExpectedPreviousToken != "" && s.ExpectedPreviousToken != a.lastToken() {
+			a.lock.Unlock()
+			return
+		}
+	}
+
+	a.queue = append(a.queue, s)
+
+	select {
+	case <-a.idle:
+		a.idle = make(chan struct{})
+	default:
+	}
+
+	a.lock.Unlock()
+
+	a.next()
+}
+
+// lastToken is the token of whatever will have played last once the
+// queue is done.
+func (a *AudioPlayer) lastToken() string {
+	if len(a.queue) > 0 {
+		return a.queue[len(a.queue)-1].Token
+	}
+
+	return a.token
+}
+
+// Stop stops what's playing, leaving the queue be. Nothing more is
+// played until AVS says so.
+func (a *AudioPlayer) Stop() {
+	if !a.stop() {
+		return
+	}
+
+	a.lock.Lock()
+	if a.current == nil {
+		a.closeIdle()
+	}
+	a.lock.Unlock()
+}
+
+// stop stops what's playing, if anything, and reports whether there
+// was.
+func (a *AudioPlayer) stop() bool {
+	a.lock.Lock()
+	p := a.current
+	if p != nil {
+		p.stopped = true
+	}
+	a.lock.Unlock()
+
+	if p == nil {
+		return false
+	}
+
+	p.cancel()
+	a.Player.Stop()
+
+	// Wait for PlaybackStopped to have gone out.
+	<-p.done
+
+	return true
+}
+
+// ClearQueue empties the queue; with CLEAR_ALL it stops what's playing
+// too.
+func (a *AudioPlayer) ClearQueue(behavior string) {
+	if behavior == directives.ClearAll {
+		a.Stop()
+	}
+
+	a.lock.Lock()
+	a.queue = nil
+	a.lock.Unlock()
+
+	a.report("PlaybackQueueCleared", nil)
+}
+
+// Pause holds playback, for instance while alexa is talking, until
+// Resume.
+func (a *AudioPlayer) Pause() {
+	a.pause()
+}
+
+// pause reports whether there was anything playing to pause.
+func (a *AudioPlayer) pause() bool {
+	if !a.setActivity(ActivityPlaying, ActivityPaused) {
+		return false
+	}
+
+	a.Player.Pause()
+	a.report("PlaybackPaused", a.progress())
+
+	return true
+}
+
+func (a *AudioPlayer) Resume() {
+	if !a.setActivity(ActivityPaused, ActivityPlaying) {
+		return
+	}
+
+	a.Player.Resume()
+	a.report("PlaybackResumed", a.progress())
+}
+
+// FocusChanged ducks or pauses playback while something more
+// important is going on, and stops it when something else takes over
+// the channel.
+func (a *AudioPlayer) FocusChanged(focus Focus) {
+	a.focus.follow(focus, a.Player, a.pause, a.Resume, a.Stop)
+}
+
+func (a *AudioPlayer) setActivity(from, to string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.activity != from {
+		return false
+	}
+
+	a.activity = to
+	return true
+}
+
+// Close stops playing and forgets the queue.
+func (a *AudioPlayer) Close() error {
+	a.lock.Lock()
+	a.queue = nil
+	a.lock.Unlock()
+
+	a.Stop()
+
+	return nil
+}
+
+// Idle is closed once everything queued has been played, or playback
+// has been stopped.
+func (a *AudioPlayer) Idle() <-chan struct{} {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.idle
+}
+
+type playbackState struct {
+	Token          string `json:"token"`
+	OffsetInMillis int64  `json:"offsetInMilliseconds"`
+	PlayerActivity string `json:"playerActivity"`
+}
+
+// State is the AudioPlayer.PlaybackState to send as context.
+func (a *AudioPlayer) State() avs.State {
+	return avs.State{
+		Header:  avs.Header{Namespace: "AudioPlayer", Name: "PlaybackState"},
+		Payload: a.playbackState(),
+	}
+}
+
+func (a *AudioPlayer) playbackState() playbackState {
+	p := a.progress()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return playbackState{p.Token, p.OffsetInMillis, a.activity}
+}
+
+type progress struct {
+	Token          string `json:"token"`
+	OffsetInMillis int64  `json:"offsetInMilliseconds"`
+}
+
+// progress is where in which stream playback is.
+func (a *AudioPlayer) progress() progress {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	offset := a.offset
+	if a.current != nil && a.current.started {
+		offset = a.position(a.current)
+	}
+
+	return progress{a.token, int64(offset / time.Millisecond)}
+}
+
+func (a *AudioPlayer) position(p *playing) time.Duration {
+	return p.start + a.Player.Position()
+}
+
+func (a *AudioPlayer) report(name string, payload interface{}) {
+	if a.Report != nil {
+		a.Report(avs.NewEvent("AudioPlayer", name, payload))
+	}
+}
+
+// next starts on the next item in the queue, unless something is
+// playing already.
+func (a *AudioPlayer) next() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.current != nil {
+		return
+	}
+
+	if len(a.queue) == 0 {
+		a.closeIdle()
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := &playing{
+		stream: a.queue[0],
+		start:  time.Duration(a.queue[0].OffsetInMilliseconds) * time.Millisecond,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	a.queue = a.queue[1:]
+	a.current = p
+	a.token = p.stream.Token
+	a.offset = p.start
+
+	go a.play(ctx, p)
+}
+
+// closeIdle lets whoever waits on Idle know nothing is playing. The
+// lock must be held.
+func (a *AudioPlayer) closeIdle() {
+	select {
+	case <-a.idle:
+	default:
+		close(a.idle)
+	}
+}
+
+// offsetPlayer is a Player that can start part way into the audio.
+type offsetPlayer interface {
+	PlayFrom(r io.Reader, offset time.Duration) error
+}
+
+// play plays p and reports how that went, then moves on to the next
+// item unless p was stopped.
+func (a *AudioPlayer) play(ctx context.Context, p *playing) {
+	err := a.playStream(ctx, p)
+
+	a.lock.Lock()
+
+	if p.started {
+		a.offset = a.position(p)
+	}
+
+	stopped := p.stopped
+	state := playbackState{p.stream.Token, int64(a.offset / time.Millisecond), a.activity}
+
+	if stopped || err != nil {
+		a.activity = ActivityStopped
+	} else {
+		a.activity = ActivityFinished
+	}
+
+	a.lock.Unlock()
+
+	at := progress{state.Token, state.OffsetInMillis}
+
+	switch {
+	case stopped && p.started:
+		a.report("PlaybackStopped", at)
+	case stopped:
+	case err != nil:
+		a.report("PlaybackFailed", playbackFailed{
+			Token:                p.stream.Token,
+			CurrentPlaybackState: state,
+			Error:                mediaError{mediaErrorType(err), err.Error()},
+		})
+	default:
+		a.report("PlaybackFinished", at)
+	}
+
+	a.lock.Lock()
+	a.current = nil
+	a.lock.Unlock()
+
+	close(p.done)
+
+	if !stopped {
+		a.next()
+	}
+}
+
+func (a *AudioPlayer) playStream(ctx context.Context, p *playing) error {
+	defer p.cancel()
+
+	r, err := openStream(ctx, a.HTTPClient, p.stream)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	op, seeks := a.Player.(offsetPlayer)
+
+	a.lock.Lock()
+	if p.stopped {
+		a.lock.Unlock()
+		return nil
+	}
+
+	if !seeks {
+		p.start = 0
+	}
+
+	p.started = true
+	a.activity = ActivityPlaying
+	a.lock.Unlock()
+
+	// Nothing carries over from pausing the last item; the focus
+	// decides afresh.
+	a.Player.Resume()
+
+	if a.Focus != nil {
+		release := a.Focus.Acquire(ContentChannel, a)
+		defer release()
+	}
+
+	var (
+		done     = make(chan struct{})
+		read     = make(chan struct{})
+		reported = make(chan struct{})
+		src      = &streamReader{ctx: ctx, r: r}
+	)
+
+	src.eof = func() { close(read) }
+
+	go func() {
+		defer close(reported)
+		a.reportProgress(p, read, done)
+	}()
+
+	if seeks {
+		err = op.PlayFrom(src, p.start)
+	} else {
+		err = a.Player.Play(src)
+	}
+
+	close(done)
+	<-reported
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+// reportProgress follows p's position until done is closed. It sends
+// PlaybackStarted once p can be heard, PlaybackNearlyFinished once the
+// player has read all of it, when the next one can be fetched, and the
+// progress reports p asks for. Whatever of the first two is still due
+// when done is closed is sent then.
+func (a *AudioPlayer) reportProgress(p *playing, read, done <-chan struct{}) {
+	var (
+		report   = p.stream.ProgressReport
+		delay    = time.Duration(report.DelayInMilliseconds) * time.Millisecond
+		interval = time.Duration(report.IntervalInMilliseconds) * time.Millisecond
+		next     time.Duration
+		started  bool
+	)
+
+	if delay <= p.start {
+		delay = 0
+	}
+
+	if interval > 0 {
+		next = (p.start/interval + 1) * interval
+	}
+
+	tick := time.NewTicker(progressTick)
+	defer tick.Stop()
+
+	for {
+		var finished bool
+
+		select {
+		case <-done:
+			finished = true
+		case <-tick.C:
+		}
+
+		a.lock.Lock()
+		pos := a.position(p)
+		a.lock.Unlock()
+
+		if !started && (pos > p.start || finished) {
+			a.report("PlaybackStarted", progress{p.stream.Token, int64(p.start / time.Millisecond)})
+			started = true
+		}
+
+		if started {
+			select {
+			case <-read:
+				a.report("PlaybackNearlyFinished", progress{p.stream.Token, int64(pos / time.Millisecond)})
+				read = nil
+			default:
+			}
+		}
+
+		if finished {
+			return
+		}
+
+		if delay > 0 && pos >= delay {
+			a.report("ProgressReportDelayElapsed", progress{p.stream.Token, int64(delay / time.Millisecond)})
+			delay = 0
+		}
+
+		for interval > 0 && pos >= next {
+			a.report("ProgressReportIntervalElapsed", progress{p.stream.Token, int64(next / time.Millisecond)})
+			next += interval
+		}
+	}
+}
+
+// streamReader stops reading a stream once ctx is done, and calls eof
+// when it has all been read.
+type streamReader struct {
+	ctx context.Context
+	r   io.Reader
+	eof func()
+}
+
+func (s *streamReader) Read(b []byte) (int, error) {
+	err := s.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := s.r.Read(b)
+	if err == io.EOF && s.eof != nil {
+		s.eof()
+		s.eof = nil
+	}
+
+	return n, err
+}
+
+type mediaError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type playbackFailed struct {
+	Token                string        `json:"token"`
+	CurrentPlaybackState playbackState `json:"currentPlaybackState"`
+	Error                mediaError    `json:"error"`
+}
+
+// mediaErrorType sorts err into one of the kinds of error
+// PlaybackFailed knows.
+func mediaErrorType(err error) string {
+	e, ok := err.(*HTTPError)
+
+	switch {
+	case !ok:
+		return "MEDIA_ERROR_UNKNOWN"
+	case e.StatusCode == http.StatusServiceUnavailable:
+		return "MEDIA_ERROR_SERVICE_UNAVAILABLE"
+	case e.StatusCode >= 500:
+		return "MEDIA_ERROR_INTERNAL_SERVER_ERROR"
+	default:
+		return "MEDIA_ERROR_INVALID_REQUEST"
+	}
+}
@@ -0,0 +1,328 @@
+package alexa
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/avs"
+	"github.com/Fruchtgummi/alexa/directives"
+)
+
+// streamPlayer reads what it plays a little at a time, as if it took a
+// millisecond to play every 100 bytes.
+type streamPlayer struct {
+	lock    sync.Mutex
+	played  int
+	stopped bool
+}
+
+func (p *streamPlayer) Play(r io.Reader) error {
+	p.lock.Lock()
+	p.played, p.stopped = 0, false
+	p.lock.Unlock()
+
+	buf := make([]byte, 1000)
+
+	for {
+		p.lock.Lock()
+		stopped := p.stopped
+		p.lock.Unlock()
+
+		if stopped {
+			return nil
+		}
+
+		n, err := r.Read(buf)
+
+		p.lock.Lock()
+		p.played += n
+		p.lock.Unlock()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (p *streamPlayer) Stop() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.stopped = true
+
+	return nil
+}
+
+func (p *streamPlayer) Pause() error  { return nil }
+func (p *streamPlayer) Resume() error { return nil }
+
+func (p *streamPlayer) Position() time.Duration {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return time.Duration(p.played) * time.Millisecond / 100
+}
+
+// playback collects the AudioPlayer events, with the token and offset
+// they're about.
+type playback struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (p *playback) report(ev avs.Event) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s := ev.Header.Name
+
+	switch pl := ev.Payload.(type) {
+	case progress:
+		s += fmt.Sprintf(" %s@%d", pl.Token, pl.OffsetInMillis)
+	case playbackFailed:
+		s += " " + pl.Token
+	}
+
+	p.events = append(p.events, s)
+}
+
+func (p *playback) list() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return append([]string(nil), p.events...)
+}
+
+// streamServer serves 100 bytes of mp3 for every millisecond of the
+// length in the path, like /a/500, and counts the requests.
+type streamServer struct {
+	*httptest.Server
+
+	lock     sync.Mutex
+	requests map[string]int
+}
+
+func newStreamServer(t *testing.T) *streamServer {
+	s := &streamServer{requests: make(map[string]int)}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.requests[r.URL.Path]++
+		s.lock.Unlock()
+
+		var (
+			name string
+			ms   int
+		)
+
+		_, err := fmt.Sscanf(r.URL.Path, "/%1s/%d", &name, &ms)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write(bytes.Repeat([]byte(name), 100*ms))
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *streamServer) fetched(path string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.requests[path]
+}
+
+func playDirective(behavior, token, url, previous string) *directives.Play {
+	d := &directives.Play{PlayBehavior: behavior}
+	d.AudioItem.Stream = directives.Stream{URL: url, Token: token, ExpectedPreviousToken: previous}
+
+	return d
+}
+
+func waitIdle(t *testing.T, a *AudioPlayer) {
+	select {
+	case <-a.Idle():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the AudioPlayer never went idle")
+	}
+}
+
+func TestAudioPlayerReplaceAll(t *testing.T) {
+	var (
+		s = newStreamServer(t)
+		p playback
+		a = NewAudioPlayer(&streamPlayer{}, p.report)
+	)
+
+	a.Play(playDirective(directives.ReplaceAll, "long", s.URL+"/a/5000", ""))
+	a.Play(playDirective(directives.Enqueue, "next", s.URL+"/b/100", "long"))
+
+	time.Sleep(200 * time.Millisecond)
+
+	a.Play(playDirective(directives.ReplaceAll, "now", s.URL+"/c/100", ""))
+
+	waitIdle(t, a)
+
+	got := p.list()
+	want := []string{"PlaybackStarted long@0", "PlaybackStopped long", "PlaybackStarted now@0", "PlaybackNearlyFinished now@100", "PlaybackFinished now@100"}
+
+	if len(got) != len(want) || got[0] != want[0] || !strings.HasPrefix(got[1], want[1]+"@") || fmt.Sprint(got[2:]) != fmt.Sprint(want[2:]) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+
+	if s.fetched("/b/100") != 0 {
+		t.Error("what was queued behind the replaced item was played")
+	}
+
+	if st := a.playbackState(); st.Token != "now" || st.PlayerActivity != ActivityFinished {
+		t.Errorf("ended up %+v, want now FINISHED", st)
+	}
+}
+
+func TestAudioPlayerEnqueue(t *testing.T) {
+	var (
+		s = newStreamServer(t)
+		p playback
+		a = NewAudioPlayer(&streamPlayer{}, p.report)
+	)
+
+	a.Play(playDirective(directives.ReplaceAll, "one", s.URL+"/a/100", ""))
+	a.Play(playDirective(directives.Enqueue, "stale", s.URL+"/b/100", "elsewhere"))
+	a.Play(playDirective(directives.Enqueue, "two", s.URL+"/c/100", "one"))
+
+	waitIdle(t, a)
+
+	got := p.list()
+	want := []string{
+		"PlaybackStarted one@0", "PlaybackNearlyFinished one@100", "PlaybackFinished one@100",
+		"PlaybackStarted two@0", "PlaybackNearlyFinished two@100", "PlaybackFinished two@100",
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+
+	if s.fetched("/b/100") != 0 {
+		t.Error("an item following on from another token was played")
+	}
+}
+
+func TestAudioPlayerProgressReports(t *testing.T) {
+	var (
+		s = newStreamServer(t)
+		p playback
+		a = NewAudioPlayer(&streamPlayer{}, p.report)
+		d = playDirective(directives.ReplaceAll, "one", s.URL+"/a/1000", "")
+	)
+
+	d.AudioItem.Stream.ProgressReport.DelayInMilliseconds = 200
+	d.AudioItem.Stream.ProgressReport.IntervalInMilliseconds = 300
+
+	a.Play(d)
+	waitIdle(t, a)
+
+	var reports []string
+	for _, e := range p.list() {
+		if strings.HasPrefix(e, "ProgressReport") {
+			reports = append(reports, e)
+		}
+	}
+
+	want := []string{
+		"ProgressReportDelayElapsed one@200",
+		"ProgressReportIntervalElapsed one@300",
+		"ProgressReportIntervalElapsed one@600",
+		"ProgressReportIntervalElapsed one@900",
+	}
+
+	// The interval one due at the end can go either way.
+	if len(reports) < len(want) || fmt.Sprint(reports[:len(want)]) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", reports, want)
+	}
+}
+
+// lateStart is a streamPlayer that takes a while to get going.
+type lateStart struct {
+	streamPlayer
+}
+
+func (p *lateStart) Play(r io.Reader) error {
+	time.Sleep(300 * time.Millisecond)
+	return p.streamPlayer.Play(r)
+}
+
+func TestAudioPlayerStartedAndNearlyFinished(t *testing.T) {
+	var (
+		s = newStreamServer(t)
+		p playback
+		a = NewAudioPlayer(&lateStart{}, p.report)
+	)
+
+	a.Play(playDirective(directives.ReplaceAll, "one", s.URL+"/a/1000", ""))
+	time.Sleep(200 * time.Millisecond)
+
+	// The stream is open by now, but nothing has been heard.
+	if got := p.list(); len(got) != 0 {
+		t.Errorf("got %v before playback started", got)
+	}
+
+	waitIdle(t, a)
+
+	got := p.list()
+	want := []string{"PlaybackStarted one@0", "PlaybackNearlyFinished one@1000", "PlaybackFinished one@1000"}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+}
+
+func TestAudioPlayerIdleAfterStop(t *testing.T) {
+	var (
+		s = newStreamServer(t)
+		a = NewAudioPlayer(&streamPlayer{}, nil)
+	)
+
+	a.Play(playDirective(directives.ReplaceAll, "long", s.URL+"/a/5000", ""))
+	time.Sleep(100 * time.Millisecond)
+
+	a.Stop()
+	waitIdle(t, a)
+}
+
+func TestAACWithoutFFmpeg(t *testing.T) {
+	dir, err := ioutil.TempDir("", "path")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir)
+	defer os.Setenv("PATH", path)
+
+	_, err = transcodeAAC(ioutil.NopCloser(strings.NewReader("aac")))
+	if err != ErrNoFFmpeg {
+		t.Errorf("got %v, want ErrNoFFmpeg", err)
+	}
+}
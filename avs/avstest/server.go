@@ -0,0 +1,312 @@
+// Package avstest is a stand-in for the Alexa Voice Service. It speaks
+// the same multipart protocol as the real thing so that a full round
+// trip can be done without talking to Amazon.
+package avstest
+
+import (
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/avs"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Request is an event as the server received it.
+type Request struct {
+	Token   string
+	Message *avs.Message
+	Audio   []byte
+}
+
+// Reply is what the server sends back for a Request. A nil Reply, or
+// one without directives, is sent as a 204.
+type Reply struct {
+	Directives []*avs.Directive
+	Audio      map[string][]byte
+}
+
+type Server struct {
+	// Respond decides what to send back for a request. When nil,
+	// every Recognize is answered by speaking Speech.
+	Respond func(*Request) *Reply
+
+	// Speech is the audio the default Respond speaks.
+	Speech []byte
+
+	// ReadRate, in bytes per second, slows down reading requests to
+	// mimic a slow uplink or a recognizer working in real time. 32000
+	// is real time for 16kHz L16. Zero reads as fast as possible.
+	ReadRate int
+
+	lock         sync.Mutex
+	requests     []*Request
+	downchannels map[*downchannel]struct{}
+	connects     int
+}
+
+type downchannel struct {
+	directives chan *avs.Directive
+	drop       chan struct{}
+	gone       chan struct{}
+}
+
+// Requests returns every request received so far.
+func (s *Server) Requests() []*Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]*Request(nil), s.requests...)
+}
+
+// Speak returns a reply holding a single SpeechSynthesizer.Speak
+// directive for audio.
+func Speak(dialogRequestId string, audio []byte) *Reply {
+	cid := avs.NewId()
+
+	return &Reply{
+		Directives: []*avs.Directive{
+			Directive("SpeechSynthesizer", "Speak", dialogRequestId, map[string]string{
+				"url":    "cid:" + cid,
+				"format": "AUDIO_MPEG",
+				"token":  avs.NewId(),
+			}),
+		},
+		Audio: map[string][]byte{cid: audio},
+	}
+}
+
+// Directive builds a directive with the given payload, panicking if
+// the payload can't be encoded.
+func Directive(namespace, name, dialogRequestId string, payload interface{}) *avs.Directive {
+	ev := avs.NewEvent(namespace, name, payload)
+
+	data, err := json.Marshal(ev.Payload)
+	if err != nil {
+		panic(err)
+	}
+
+	ev.Header.DialogRequestId = dialogRequestId
+
+	return &avs.Directive{Header: ev.Header, Payload: data}
+}
+
+func (s *Server) respond(req *Request) *Reply {
+	if s.Respond != nil {
+		return s.Respond(req)
+	}
+
+	ev := req.Message.Event
+	if ev.Header.Namespace == "SpeechRecognizer" && ev.Header.Name == "Recognize" {
+		return Speak(ev.Header.DialogRequestId, s.Speech)
+	}
+
+	return nil
+}
+
+// Connects returns how many times a downchannel has been opened.
+func (s *Server) Connects() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.connects
+}
+
+// Push sends d down every open downchannel and returns how many there
+// were.
+func (s *Server) Push(d *avs.Directive) int {
+	s.lock.Lock()
+	var open []*downchannel
+	for dc := range s.downchannels {
+		open = append(open, dc)
+	}
+	s.lock.Unlock()
+
+	n := 0
+	for _, dc := range open {
+		select {
+		case dc.directives <- d:
+			n++
+		case <-dc.gone:
+		}
+	}
+
+	return n
+}
+
+// Disconnect ends every open downchannel, as AVS does now and then.
+func (s *Server) Disconnect() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for dc := range s.downchannels {
+		close(dc.drop)
+		delete(s.downchannels, dc)
+	}
+}
+
+// Handler returns the server wrapped to accept HTTP/2 without TLS, as
+// the downchannel needs.
+func (s *Server) Handler() http.Handler {
+	return h2c.NewHandler(s, &http2.Server{})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	token := strings.TrimSpace(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer"))
+	if token == "" {
+		writeError(w, http.StatusForbidden, "INVALID_REQUEST_EXCEPTION", "missing access token")
+		return
+	}
+
+	switch {
+	case req.Method == "POST" && req.URL.Path == avs.EventsPath:
+		s.serveEvent(w, req, token)
+	case req.Method == "GET" && req.URL.Path == avs.DirectivesPath:
+		s.serveDirectives(w, req)
+	case req.Method == "GET" && req.URL.Path == avs.PingPath:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (s *Server) serveDirectives(w http.ResponseWriter, req *http.Request) {
+	dc := &downchannel{
+		directives: make(chan *avs.Directive, 16),
+		drop:       make(chan struct{}),
+		gone:       make(chan struct{}),
+	}
+
+	s.lock.Lock()
+	if s.downchannels == nil {
+		s.downchannels = make(map[*downchannel]struct{})
+	}
+	s.downchannels[dc] = struct{}{}
+	s.connects++
+	s.lock.Unlock()
+
+	defer func() {
+		close(dc.gone)
+
+		s.lock.Lock()
+		delete(s.downchannels, dc)
+		s.lock.Unlock()
+	}()
+
+	mw := multipart.NewWriter(w)
+
+	w.Header().Set("Content-Type", `multipart/related; boundary=`+mw.Boundary()+`; type="application/json"`)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-dc.drop:
+			mw.Close()
+			return
+		case d := <-dc.directives:
+			err := avs.WriteDirective(mw, d)
+			if err != nil {
+				return
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func (s *Server) serveEvent(w http.ResponseWriter, req *http.Request, token string) {
+	if s.ReadRate > 0 {
+		req.Body = &throttle{ReadCloser: req.Body, rate: s.ReadRate, start: time.Now()}
+	}
+
+	msg, audio, err := avs.ReadEvent(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_EXCEPTION", err.Error())
+		return
+	}
+
+	r := &Request{Token: token, Message: msg, Audio: audio}
+
+	s.lock.Lock()
+	s.requests = append(s.requests, r)
+	s.lock.Unlock()
+
+	reply := s.respond(r)
+	if reply == nil || len(reply.Directives) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	mw := multipart.NewWriter(w)
+
+	w.Header().Set("Content-Type", `multipart/related; boundary=`+mw.Boundary()+`; type="application/json"`)
+	w.WriteHeader(http.StatusOK)
+
+	for _, d := range reply.Directives {
+		err = avs.WriteDirective(mw, d)
+		if err != nil {
+			return
+		}
+	}
+
+	for cid, data := range reply.Audio {
+		err = avs.WriteAudio(mw, cid, data)
+		if err != nil {
+			return
+		}
+	}
+
+	mw.Close()
+}
+
+// throttle reads no faster than rate bytes per second.
+type throttle struct {
+	io.ReadCloser
+	rate  int
+	start time.Time
+	n     int
+}
+
+func (t *throttle) Read(p []byte) (int, error) {
+	if max := t.rate / 50; max > 0 && len(p) > max {
+		p = p[:max]
+	}
+
+	n, err := t.ReadCloser.Read(p)
+	t.n += n
+
+	due := t.start.Add(time.Duration(t.n) * time.Second / time.Duration(t.rate))
+	time.Sleep(due.Sub(time.Now()))
+
+	return n, err
+}
+
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"header": map[string]string{
+			"namespace": "System",
+			"name":      "Exception",
+		},
+		"payload": map[string]string{
+			"code":        code,
+			"description": description,
+		},
+	})
+}
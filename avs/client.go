@@ -0,0 +1,26 @@
+package avs
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+)
+
+// NewClient returns an http.Client that only talks HTTP/2, which AVS
+// requires for the downchannel. An http:// endpoint is spoken to with
+// h2c, which is how local stand-ins are reached.
+func NewClient(endpoint string) *http.Client {
+	t := &http2.Transport{}
+
+	if strings.HasPrefix(endpoint, "http://") {
+		t.AllowHTTP = true
+		t.DialTLS = func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		}
+	}
+
+	return &http.Client{Transport: t}
+}
@@ -0,0 +1,268 @@
+package avs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DirectivesPath = "/v20160207/directives"
+	PingPath       = "/ping"
+
+	DefaultPingInterval = 5 * time.Minute
+	DefaultMaxBackoff   = time.Minute
+)
+
+// Downchannel keeps a GET on the directives path open for as long as
+// it runs, handing every directive AVS pushes down it to Directives.
+// When the stream drops it's opened again, backing off while the
+// server keeps failing.
+type Downchannel struct {
+	// Client must speak HTTP/2, see NewClient. Events for the same
+	// session should be sent with the same client so they share the
+	// connection.
+	Client   *http.Client
+	Endpoint string
+	Token    func() (string, error)
+
+	// Context is reported in the System.SynchronizeState event sent
+	// every time the stream is (re)opened. Defaults to DefaultContext.
+	Context func() []State
+
+	// Directives is given every directive pushed down the stream, in
+	// order, usually to hand on to a directives.Dispatcher.
+	Directives func(*Directive)
+
+	// Connected is called with the number of the connection every
+	// time the stream is opened, after SynchronizeState was sent.
+	Connected func(n int)
+
+	PingInterval time.Duration
+	MaxBackoff   time.Duration
+
+	lock   sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Start opens the stream in the background. A Downchannel is only
+// started once; calling Start again does nothing.
+func (dc *Downchannel) Start() {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	if dc.cancel != nil {
+		return
+	}
+
+	dc.ctx, dc.cancel = context.WithCancel(context.Background())
+
+	dc.wg.Add(2)
+	go dc.run()
+	go dc.ping()
+}
+
+// Close shuts the stream down, along with any request it's making,
+// and waits for the background work to finish. A Downchannel that was
+// never started has nothing to close.
+func (dc *Downchannel) Close() error {
+	dc.lock.Lock()
+	cancel := dc.cancel
+	dc.lock.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	dc.wg.Wait()
+
+	return nil
+}
+
+func (dc *Downchannel) closed() bool {
+	return dc.ctx.Err() != nil
+}
+
+func (dc *Downchannel) run() {
+	defer dc.wg.Done()
+
+	var (
+		backoff time.Duration
+		n       int
+	)
+
+	maxBackoff := dc.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+
+	for !dc.closed() {
+		n++
+
+		err := dc.stream(n)
+		if dc.closed() {
+			return
+		}
+
+		if err == nil {
+			backoff = 0
+		} else {
+			log.Printf("downchannel: %s", err)
+
+			if backoff == 0 {
+				backoff = 250 * time.Millisecond
+			} else if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+
+		select {
+		case <-dc.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (dc *Downchannel) request(method, path string) (*http.Request, error) {
+	req, err := http.NewRequest(method, dc.Endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(dc.ctx)
+
+	token, err := dc.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req, nil
+}
+
+// stream opens the directives stream and reads from it until it ends.
+// A stream that ends cleanly returns nil.
+func (dc *Downchannel) stream(n int) error {
+	req, err := dc.request("GET", DirectivesPath)
+	if err != nil {
+		return err
+	}
+
+	resp, err := dc.Client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	err = dc.synchronize()
+	if err != nil {
+		return err
+	}
+
+	if dc.Connected != nil {
+		dc.Connected(n)
+	}
+
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			if dc.closed() {
+				return nil
+			}
+			return fmt.Errorf("directives stream ended: %s", err)
+		}
+
+		if p.Header.Get("Content-ID") != "" {
+			continue
+		}
+
+		d, err := readDirective(p)
+		if err != nil {
+			return err
+		}
+
+		if dc.Directives != nil {
+			dc.Directives(d)
+		}
+	}
+}
+
+func (dc *Downchannel) synchronize() error {
+	token, err := dc.Token()
+	if err != nil {
+		return err
+	}
+
+	ctx := dc.Context
+	if ctx == nil {
+		ctx = DefaultContext
+	}
+
+	msg := &Message{
+		Context: ctx(),
+		Event:   NewEvent("System", "SynchronizeState", nil),
+	}
+
+	_, err = PostEvent(dc.ctx, dc.Client, dc.Endpoint, token, msg, nil)
+	return err
+}
+
+func (dc *Downchannel) ping() {
+	defer dc.wg.Done()
+
+	interval := dc.PingInterval
+	if interval == 0 {
+		interval = DefaultPingInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		req, err := dc.request("GET", PingPath)
+		if err != nil {
+			log.Printf("downchannel: ping: %s", err)
+			continue
+		}
+
+		resp, err := dc.Client.Do(req)
+		if err != nil {
+			if !dc.closed() {
+				log.Printf("downchannel: ping: %s", err)
+			}
+
+			continue
+		}
+
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,204 @@
+package avs_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/avs"
+	"github.com/Fruchtgummi/alexa/avs/avstest"
+)
+
+func token() (string, error) {
+	return "token", nil
+}
+
+// startDownchannel opens a downchannel to s, returning the directives
+// it gets and the numbers of its connections as they come.
+func startDownchannel(t *testing.T, s *avstest.Server) (*avs.Downchannel, chan *avs.Directive, chan int) {
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	var (
+		directives = make(chan *avs.Directive, 16)
+		connected  = make(chan int, 16)
+	)
+
+	dc := &avs.Downchannel{
+		Client:     avs.NewClient(ts.URL),
+		Endpoint:   ts.URL,
+		Token:      token,
+		MaxBackoff: 10 * time.Millisecond,
+		Directives: func(d *avs.Directive) {
+			directives <- d
+		},
+		Connected: func(n int) {
+			connected <- n
+		},
+	}
+
+	dc.Start()
+	t.Cleanup(func() { dc.Close() })
+
+	return dc, directives, connected
+}
+
+func waitConnected(t *testing.T, connected chan int, want int) {
+	select {
+	case n := <-connected:
+		if n != want {
+			t.Fatalf("connection #%d, want #%d", n, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("connection #%d never came", want)
+	}
+}
+
+func waitDirective(t *testing.T, directives chan *avs.Directive) *avs.Directive {
+	select {
+	case d := <-directives:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no directive came down the downchannel")
+		return nil
+	}
+}
+
+func TestDownchannelParses(t *testing.T) {
+	s := &avstest.Server{}
+
+	_, directives, connected := startDownchannel(t, s)
+	waitConnected(t, connected, 1)
+
+	reqs := s.Requests()
+	if len(reqs) != 1 || !isEvent(reqs[0], "System", "SynchronizeState") {
+		t.Fatalf("server got %d requests, want a SynchronizeState", len(reqs))
+	}
+
+	s.Push(avstest.Directive("Alerts", "SetAlert", "", map[string]string{"token": "alarm"}))
+	s.Push(avstest.Directive("AudioPlayer", "Stop", "", nil))
+
+	d := waitDirective(t, directives)
+	if !d.Is("Alerts", "SetAlert") {
+		t.Fatalf("got %s.%s, want Alerts.SetAlert", d.Header.Namespace, d.Header.Name)
+	}
+
+	var alert struct{ Token string }
+
+	err := d.Decode(&alert)
+	if err != nil || alert.Token != "alarm" {
+		t.Errorf("SetAlert payload %s decodes to %+v, %v", d.Payload, alert, err)
+	}
+
+	if d := waitDirective(t, directives); !d.Is("AudioPlayer", "Stop") {
+		t.Fatalf("got %s.%s, want AudioPlayer.Stop", d.Header.Namespace, d.Header.Name)
+	}
+}
+
+func TestDownchannelReconnects(t *testing.T) {
+	s := &avstest.Server{}
+
+	_, directives, connected := startDownchannel(t, s)
+	waitConnected(t, connected, 1)
+
+	s.Disconnect()
+	waitConnected(t, connected, 2)
+
+	if n := s.Connects(); n != 2 {
+		t.Errorf("server saw %d connects, want 2", n)
+	}
+
+	var syncs int
+	for _, r := range s.Requests() {
+		if isEvent(r, "System", "SynchronizeState") {
+			syncs++
+		}
+	}
+
+	if syncs != 2 {
+		t.Errorf("got %d SynchronizeState events, want one per connection", syncs)
+	}
+
+	s.Push(avstest.Directive("Speaker", "SetMute", "", map[string]bool{"mute": true}))
+
+	if d := waitDirective(t, directives); !d.Is("Speaker", "SetMute") {
+		t.Fatalf("got %s.%s after reconnecting, want Speaker.SetMute", d.Header.Namespace, d.Header.Name)
+	}
+}
+
+func TestDownchannelCloseWhileSynchronizing(t *testing.T) {
+	var (
+		s       = &avstest.Server{}
+		release = make(chan struct{})
+	)
+
+	defer close(release)
+
+	// The server never answers SynchronizeState.
+	s.Respond = func(*avstest.Request) *avstest.Reply {
+		<-release
+		return nil
+	}
+
+	dc, _, _ := startDownchannel(t, s)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Requests()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	closed := make(chan struct{})
+
+	go func() {
+		dc.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close is stuck behind SynchronizeState")
+	}
+}
+
+func TestDownchannelStartTwice(t *testing.T) {
+	s := &avstest.Server{}
+
+	dc, _, connected := startDownchannel(t, s)
+	dc.Start()
+
+	waitConnected(t, connected, 1)
+
+	select {
+	case n := <-connected:
+		t.Fatalf("connection #%d from starting again", n)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	closed := make(chan struct{})
+
+	go func() {
+		dc.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close is stuck after starting twice")
+	}
+}
+
+func TestDownchannelCloseUnstarted(t *testing.T) {
+	dc := &avs.Downchannel{}
+
+	err := dc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func isEvent(r *avstest.Request, namespace, name string) bool {
+	h := r.Message.Event.Header
+	return h.Namespace == namespace && h.Name == name
+}
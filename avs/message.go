@@ -0,0 +1,162 @@
+// Package avs implements the wire format of the Alexa Voice Service
+// v20160207 API: events sent to /v20160207/events and the multipart
+// responses full of directives that come back.
+package avs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+)
+
+const (
+	DefaultEndpoint = "https://avs-alexa-na.amazon.com"
+	EventsPath      = "/v20160207/events"
+	Version         = "v20160207"
+)
+
+type Header struct {
+	Namespace       string `json:"namespace"`
+	Name            string `json:"name"`
+	MessageId       string `json:"messageId,omitempty"`
+	DialogRequestId string `json:"dialogRequestId,omitempty"`
+}
+
+// Event is something we tell AVS about, like "here's some audio" or
+// "I finished playing that".
+type Event struct {
+	Header  Header      `json:"header"`
+	Payload interface{} `json:"payload"`
+}
+
+// State is an entry in the context array, reporting the state of one
+// of the client side components.
+type State struct {
+	Header  Header      `json:"header"`
+	Payload interface{} `json:"payload"`
+}
+
+// Message is the JSON that goes into the metadata part of an event
+// request.
+type Message struct {
+	Context []State `json:"context"`
+	Event   Event   `json:"event"`
+}
+
+// Directive is something AVS tells us to do. The payload is kept raw
+// so that it can be decoded into the right type once we know what
+// the directive is.
+type Directive struct {
+	Header  Header          `json:"header"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Decode unpacks the directive's payload into v.
+func (d *Directive) Decode(v interface{}) error {
+	if len(d.Payload) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(d.Payload, v)
+}
+
+// Is reports whether the directive is namespace.name.
+func (d *Directive) Is(namespace, name string) bool {
+	return d.Header.Namespace == namespace && d.Header.Name == name
+}
+
+// NewId returns a random identifier suitable for messageId and
+// dialogRequestId.
+func NewId() string {
+	var buf [16]byte
+
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(buf[:])
+}
+
+// NewEvent returns an event with a fresh messageId.
+func NewEvent(namespace, name string, payload interface{}) Event {
+	if payload == nil {
+		payload = struct{}{}
+	}
+
+	return Event{
+		Header: Header{
+			Namespace: namespace,
+			Name:      name,
+			MessageId: NewId(),
+		},
+		Payload: payload,
+	}
+}
+
+const (
+	ProfileCloseTalking = "CLOSE_TALK"
+	ProfileNearField    = "NEAR_FIELD"
+	ProfileFarField     = "FAR_FIELD"
+
+	AudioFormat = "AUDIO_L16_RATE_16000_CHANNELS_1"
+)
+
+type RecognizePayload struct {
+	Profile string `json:"profile"`
+	Format  string `json:"format"`
+
+	// Initiator is handed back from the ExpectSpeech being answered.
+	Initiator json.RawMessage `json:"initiator,omitempty"`
+}
+
+// NewRecognizeEvent returns the SpeechRecognizer.Recognize event that
+// accompanies an utterance. The dialogRequestId ties the directives
+// in the response back to this request.
+func NewRecognizeEvent(dialogRequestId string) Event {
+	ev := NewEvent("SpeechRecognizer", "Recognize", RecognizePayload{
+		Profile: ProfileCloseTalking,
+		Format:  AudioFormat,
+	})
+
+	ev.Header.DialogRequestId = dialogRequestId
+
+	return ev
+}
+
+// DefaultContext returns the context of a client that is doing
+// nothing at all: no music, no speech, no alerts, volume at 50.
+func DefaultContext() []State {
+	return []State{
+		{
+			Header: Header{Namespace: "AudioPlayer", Name: "PlaybackState"},
+			Payload: map[string]interface{}{
+				"token":                "",
+				"offsetInMilliseconds": 0,
+				"playerActivity":       "IDLE",
+			},
+		},
+		{
+			Header: Header{Namespace: "SpeechSynthesizer", Name: "SpeechState"},
+			Payload: map[string]interface{}{
+				"token":                "",
+				"offsetInMilliseconds": 0,
+				"playerActivity":       "FINISHED",
+			},
+		},
+		{
+			Header: Header{Namespace: "Alerts", Name: "AlertsState"},
+			Payload: map[string]interface{}{
+				"allAlerts":    []interface{}{},
+				"activeAlerts": []interface{}{},
+			},
+		},
+		{
+			Header: Header{Namespace: "Speaker", Name: "VolumeState"},
+			Payload: map[string]interface{}{
+				"volume": 50,
+				"muted":  false,
+			},
+		},
+	}
+}
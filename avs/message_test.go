@@ -0,0 +1,73 @@
+package avs_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Fruchtgummi/alexa/avs"
+	"github.com/Fruchtgummi/alexa/avs/avstest"
+)
+
+func TestRoundTrip(t *testing.T) {
+	s := &avstest.Server{Speech: []byte("answer")}
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	msg := &avs.Message{
+		Context: avs.DefaultContext(),
+		Event:   avs.NewRecognizeEvent("dialog"),
+	}
+
+	resp, err := avs.PostEvent(context.Background(), http.DefaultClient, ts.URL, "token", msg, bytes.NewReader([]byte{1, 2, 3, 4}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Directives) != 1 || !resp.Directives[0].Is("SpeechSynthesizer", "Speak") {
+		t.Fatalf("got directives %+v, want one Speak", resp.Directives)
+	}
+
+	d := resp.Directives[0]
+	if d.Header.DialogRequestId != "dialog" {
+		t.Errorf("Speak has dialogRequestId %q, want %q", d.Header.DialogRequestId, "dialog")
+	}
+
+	var speak struct{ URL string }
+
+	err = d.Decode(&speak)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audio, ok := resp.Content(speak.URL)
+	if !ok || string(audio) != "answer" {
+		t.Errorf("Speak audio is %q, want %q", audio, "answer")
+	}
+
+	reqs := s.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("server got %d requests, want 1", len(reqs))
+	}
+
+	if r := reqs[0]; r.Token != "token" || !bytes.Equal(r.Audio, []byte{1, 2, 3, 4}) || r.Message.Event.Header.Name != "Recognize" {
+		t.Errorf("server got %+v", r)
+	}
+}
+
+func TestRoundTripNoToken(t *testing.T) {
+	ts := httptest.NewServer(&avstest.Server{})
+	defer ts.Close()
+
+	msg := &avs.Message{Event: avs.NewRecognizeEvent("dialog")}
+
+	_, err := avs.PostEvent(context.Background(), http.DefaultClient, ts.URL, "", msg, nil)
+
+	e, ok := err.(*avs.Error)
+	if !ok || e.StatusCode != http.StatusForbidden {
+		t.Fatalf("got %v, want a 403", err)
+	}
+}
@@ -0,0 +1,279 @@
+package avs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// Response is everything that came back for an event: the directives
+// in the order they were sent, and the binary parts they refer to.
+type Response struct {
+	Directives []*Directive
+
+	// Audio is keyed by Content-ID, without the angle brackets.
+	Audio map[string][]byte
+}
+
+// Content returns the binary part a "cid:" url refers to.
+func (r *Response) Content(url string) ([]byte, bool) {
+	if !strings.HasPrefix(url, "cid:") {
+		return nil, false
+	}
+
+	data, ok := r.Audio[strings.TrimPrefix(url, "cid:")]
+	return data, ok
+}
+
+// Error is what AVS sends back instead of directives when it doesn't
+// like a request.
+type Error struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("avs: status %d", e.StatusCode)
+	}
+
+	return fmt.Sprintf("avs: status %d: %s: %s", e.StatusCode, e.Code, e.Description)
+}
+
+func readError(resp *http.Response) error {
+	var body struct {
+		Payload struct {
+			Code        string `json:"code"`
+			Description string `json:"description"`
+		} `json:"payload"`
+	}
+
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	return &Error{
+		StatusCode:  resp.StatusCode,
+		Code:        body.Payload.Code,
+		Description: body.Payload.Description,
+	}
+}
+
+// ReadResponse parses the multipart body of an events response. A 204
+// means AVS had nothing to say and gives an empty Response.
+func ReadResponse(resp *http.Response) (*Response, error) {
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return &Response{Audio: map[string][]byte{}}, nil
+	default:
+		return nil, readError(resp)
+	}
+
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	return readParts(multipart.NewReader(resp.Body, params["boundary"]))
+}
+
+func readParts(mr *multipart.Reader) (*Response, error) {
+	r := &Response{Audio: map[string][]byte{}}
+
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				return r, nil
+			}
+			return nil, err
+		}
+
+		if cid := p.Header.Get("Content-ID"); cid != "" {
+			data, err := ioutil.ReadAll(p)
+			if err != nil {
+				return nil, err
+			}
+
+			r.Audio[strings.Trim(cid, "<>")] = data
+			continue
+		}
+
+		d, err := readDirective(p)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Directives = append(r.Directives, d)
+	}
+}
+
+func readDirective(p io.Reader) (*Directive, error) {
+	var body struct {
+		Directive *Directive `json:"directive"`
+	}
+
+	err := json.NewDecoder(p).Decode(&body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body.Directive == nil {
+		return nil, fmt.Errorf("avs: json part without a directive")
+	}
+
+	return body.Directive, nil
+}
+
+// WriteEvent writes the metadata part for msg and, if audio isn't nil,
+// the audio part after it.
+func WriteEvent(w *multipart.Writer, msg *Message, audio io.Reader) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="metadata"`)
+	h.Set("Content-Type", "application/json; charset=UTF-8")
+
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	err = json.NewEncoder(part).Encode(msg)
+	if err != nil {
+		return err
+	}
+
+	if audio != nil {
+		h = make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="audio"`)
+		h.Set("Content-Type", "application/octet-stream")
+
+		part, err = w.CreatePart(h)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(part, audio)
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+// ReadEvent is the server side of WriteEvent, returning the message
+// and the audio, if any.
+func ReadEvent(req *http.Request) (*Message, []byte, error) {
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		msg   *Message
+		audio []byte
+	)
+
+	mr := multipart.NewReader(req.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, nil, err
+		}
+
+		switch p.FormName() {
+		case "metadata":
+			msg = new(Message)
+
+			err = json.NewDecoder(p).Decode(msg)
+			if err != nil {
+				return nil, nil, err
+			}
+		case "audio":
+			audio, err = ioutil.ReadAll(p)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if msg == nil {
+		return nil, nil, fmt.Errorf("avs: request without metadata")
+	}
+
+	return msg, audio, nil
+}
+
+// WriteDirective writes d as a JSON part.
+func WriteDirective(w *multipart.Writer, d *Directive) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", "application/json; charset=UTF-8")
+
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(part).Encode(struct {
+		Directive *Directive `json:"directive"`
+	}{d})
+}
+
+// WriteAudio writes data as a binary part that a directive can refer
+// to as "cid:" + cid.
+func WriteAudio(w *multipart.Writer, cid string, data []byte) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-ID", "<"+cid+">")
+
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = part.Write(data)
+	return err
+}
+
+// PostEvent sends msg, along with audio if it's not nil, to the events
+// path of endpoint and reads back the directives. The body is streamed,
+// so audio can still be being produced while the request is under
+// way. Cancelling ctx aborts both the upload and reading the response.
+func PostEvent(ctx context.Context, client *http.Client, endpoint, token string, msg *Message, audio io.Reader) (*Response, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(WriteEvent(writer, msg, audio))
+	}()
+
+	req, err := http.NewRequest("POST", endpoint+EventsPath, pr)
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	return ReadResponse(resp)
+}
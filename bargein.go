@@ -0,0 +1,142 @@
+package alexa
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultBargeInMargin is how many dB above both the noise and the
+// echo of what alexa is saying the user has to be to interrupt her.
+const DefaultBargeInMargin = 10
+
+// DefaultBargeInOnset is how long the user has to be that loud.
+const DefaultBargeInOnset = 100 * time.Millisecond
+
+// silenceLevel is the level of nothing at all, in dB.
+const silenceLevel = -100
+
+// LevelPlayer is a Player that can say how loud what it's been playing
+// is, so that its echo in the microphone can be told apart from the
+// user talking.
+type LevelPlayer interface {
+	Player
+
+	// Level is the loudest the output has been in the last quarter
+	// second or so, in dB.
+	Level() float64
+}
+
+// BargeIn listens while alexa is talking, for the user talking over
+// her: saying the wake word, or speaking up louder than her echo. How
+// loud the echo gets is learnt in the first half second of every
+// answer, if the player is a LevelPlayer.
+type BargeIn struct {
+	// Spotter, if set, interrupts on the wake word.
+	Spotter KeywordSpotter
+
+	// Margin and Onset decide how loud and for how long the user has to
+	// talk to interrupt. Zero means DefaultBargeInMargin and
+	// DefaultBargeInOnset.
+	Margin float64
+	Onset  time.Duration
+
+	// PreRoll is how much audio from before the interruption is kept
+	// for the next question. Zero means DefaultPreRoll.
+	PreRoll time.Duration
+}
+
+// echoLearn is how long at the start of an answer the echo is
+// listened to, to learn how loud it gets, before the user can barge in
+// by talking. The wake word works straight away.
+const echoLearn = 500 * time.Millisecond
+
+// echoFloor is the playback level below which there's no telling the
+// coupling from it.
+const echoFloor = -50
+
+// watch reads 16kHz mono from src while player plays, until stop is
+// closed or the user barges in. Then it returns the audio from just
+// before they did, or nil if they didn't.
+func (b *BargeIn) watch(src AudioSource, player Player, stop <-chan struct{}) ([]int16, error) {
+	var (
+		margin   = b.Margin
+		onset    = b.Onset
+		preRoll  = b.PreRoll
+		frame    = make([]int16, ListenFrame)
+		noise    NoiseFloor
+		coupling = math.Inf(-1)
+		learnt   int
+		loud     int
+	)
+
+	if margin == 0 {
+		margin = DefaultBargeInMargin
+	}
+	if onset == 0 {
+		onset = DefaultBargeInOnset
+	}
+	if preRoll == 0 {
+		preRoll = DefaultPreRoll
+	}
+
+	ring := NewRing(int(preRoll * 16000 / time.Second))
+	learn := int(echoLearn * 16000 / time.Second)
+	ref, hasRef := player.(LevelPlayer)
+
+	if b.Spotter != nil {
+		b.Spotter.Reset()
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil, nil
+		default:
+		}
+
+		err := readFull(src, frame)
+		if err != nil {
+			return nil, err
+		}
+
+		ring.Write(frame)
+
+		var (
+			db        = decibels(frame)
+			threshold = noise.Update(db, len(frame)) + margin
+			barged    = b.Spotter != nil && b.Spotter.Spot(frame)
+		)
+
+		if hasRef {
+			level := ref.Level()
+
+			// How much louder than the echo the user has to be depends
+			// on how loud the echo gets; take the loudest it is
+			// compared to what's playing while learning.
+			if level > echoFloor && learnt < learn {
+				coupling = math.Max(coupling, db-level)
+				learnt += len(frame)
+			}
+
+			if learnt < learn {
+				threshold = math.Inf(1)
+			} else {
+				threshold = math.Max(threshold, level+coupling+margin)
+			}
+		} else {
+			// Without knowing what's playing, just ask for more.
+			threshold += margin / 2
+		}
+
+		if db > threshold {
+			loud += len(frame)
+		} else {
+			loud = 0
+		}
+
+		if barged || loud >= int(onset*16000/time.Second) {
+			pre := make([]int16, ring.Len())
+			return pre[:ring.Read(pre)], nil
+		}
+	}
+}
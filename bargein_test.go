@@ -0,0 +1,90 @@
+package alexa
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/avs/avstest"
+)
+
+// talking is the user saying something at amplitude a, in a quiet room.
+func talking(a float64, d time.Duration) Segment {
+	s := Voice(140, a, d)
+	s.Noise = 0.002
+
+	return s
+}
+
+// answer is how long the fake answers take to play out when nobody
+// interrupts them.
+const answer = 2 * time.Second
+
+// converse asks alexa a question from segments, with barge-in on, and
+// returns how many questions she got, how many answers were played and
+// stopped, and how long it all took.
+func converse(t *testing.T, segments ...Segment) (questions, plays, stops int, took time.Duration) {
+	var (
+		s      = &avstest.Server{Speech: []byte("answer")}
+		player = &fakePlayer{Duration: answer, Loudness: -20}
+		start  = time.Now()
+	)
+
+	err := Listen(context.Background(), testClient(t, s), ListenOpts{
+		Source:        NewGeneratorSource(16000, segments...),
+		Detector:      NewEnergyDetector(),
+		QuietDuration: 500 * time.Millisecond,
+		Player:        player,
+		BargeIn:       &BargeIn{},
+	})
+	if err != nil && err != ErrNoSpeech {
+		t.Fatal(err)
+	}
+
+	took = time.Since(start)
+	plays, stops = player.counts()
+
+	for _, r := range s.Requests() {
+		if r.Message.Event.Header.Name == "Recognize" {
+			questions++
+		}
+	}
+
+	return questions, plays, stops, took
+}
+
+func TestBargeIn(t *testing.T) {
+	// A question, then the echo of the answer, then the user talking
+	// over it.
+	questions, plays, stops, took := converse(t,
+		Noise(0.002, time.Second),
+		talking(0.3, time.Second),
+		Noise(0.002, time.Second),
+		talking(0.01, time.Second),
+		talking(0.3, time.Second),
+		Noise(0.002, 2*time.Second),
+	)
+
+	if questions != 2 || plays != 2 || stops != 1 {
+		t.Errorf("got %d questions and %d answers, %d stopped; want the first answer interrupted by a second question", questions, plays, stops)
+	}
+
+	if took >= 2*answer {
+		t.Errorf("took %v, the interrupted answer played out", took)
+	}
+}
+
+func TestNoBargeInOnEcho(t *testing.T) {
+	// The microphone hears alexa's answer, quieter than she plays it.
+	questions, plays, stops, _ := converse(t,
+		Noise(0.002, time.Second),
+		talking(0.3, time.Second),
+		Noise(0.002, time.Second),
+		talking(0.1, 3*time.Second),
+		Noise(0.002, time.Second),
+	)
+
+	if questions != 1 || plays != 1 || stops != 0 {
+		t.Errorf("got %d questions and %d answers, %d stopped; want the answer played out", questions, plays, stops)
+	}
+}
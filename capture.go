@@ -0,0 +1,273 @@
+package alexa
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/portaudio"
+)
+
+// DefaultCaptureFrame is how much audio a Capture delivers at a time.
+const DefaultCaptureFrame = 20 * time.Millisecond
+
+// captureQueue is how many frames can wait to be read before any more
+// are dropped, a second's worth of 20ms frames.
+const captureQueue = 50
+
+// CaptureStats counts what a Capture did with the audio.
+type CaptureStats struct {
+	// Frames is how many frames were captured, and Dropped how many of
+	// them were thrown away because nobody was reading them.
+	Frames  uint64
+	Dropped uint64
+
+	// Overflows is how many times PortAudio lost input before it got
+	// to us at all.
+	Overflows uint64
+}
+
+// Lost is whether any audio was lost.
+func (s CaptureStats) Lost() bool {
+	return s.Dropped > 0 || s.Overflows > 0
+}
+
+// Capture records from an input device with a callback stream: the
+// audio is cut into frames of a fixed length as soon as PortAudio has
+// it and queued on a channel. When the queue is full the newest frame
+// is dropped and counted, rather than the device overflowing
+// unnoticed. A Capture is also an AudioSource.
+type Capture struct {
+	stream   *portaudio.Stream
+	rate     int
+	channels int
+	size     int
+
+	frames  chan []int16
+	free    chan []int16
+	pending []int16
+
+	captured uint64
+	dropped  uint64
+
+	cur  []int16
+	hold []int16
+
+	// lock keeps Stats off the stream while Close closes it; overflows
+	// is what the stream had counted by then.
+	lock      sync.Mutex
+	overflows uint64
+
+	closed sync.Once
+}
+
+// OpenCapture starts capturing from the input device spec picks (see
+// FindDevice) at its preferred rate and channels, in frames of the
+// given length. Zero means DefaultCaptureFrame.
+func OpenCapture(spec string, frame time.Duration) (*Capture, error) {
+	err := portaudio.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	defer portaudio.Terminate()
+
+	dev, err := FindDevice(spec, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if frame == 0 {
+		frame = DefaultCaptureFrame
+	}
+
+	p := InputParameters(dev)
+	p.FramesPerBuffer = int(p.SampleRate * frame.Seconds())
+
+	return OpenCaptureStream(p)
+}
+
+// OpenCaptureStream starts capturing with the given parameters, in
+// frames of FramesPerBuffer, which must be set.
+func OpenCaptureStream(p portaudio.StreamParameters) (*Capture, error) {
+	err := portaudio.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	c := newCapture(int(p.SampleRate), p.Input.Channels, p.FramesPerBuffer)
+
+	c.stream, err = portaudio.OpenStream(p, c.callback)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, err
+	}
+
+	err = c.stream.Start()
+	if err != nil {
+		c.stream.Close()
+		portaudio.Terminate()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func newCapture(rate, channels, frames int) *Capture {
+	c := &Capture{
+		rate:     rate,
+		channels: channels,
+		size:     frames * channels,
+		frames:   make(chan []int16, captureQueue),
+		free:     make(chan []int16, captureQueue),
+	}
+
+	c.pending = make([]int16, 0, 2*c.size)
+
+	for i := 0; i < captureQueue; i++ {
+		c.free <- make([]int16, c.size)
+	}
+
+	return c
+}
+
+// callback runs on PortAudio's thread, so it doesn't block and, once
+// the free frames are there, doesn't allocate. The stream counts the
+// overflows.
+func (c *Capture) callback(in []int16) {
+	c.write(in)
+}
+
+// write cuts samples into frames and queues them.
+func (c *Capture) write(samples []int16) {
+	c.pending = append(c.pending, samples...)
+
+	for len(c.pending) >= c.size {
+		c.deliver(c.pending[:c.size])
+		c.pending = c.pending[:copy(c.pending, c.pending[c.size:])]
+	}
+}
+
+func (c *Capture) deliver(samples []int16) {
+	atomic.AddUint64(&c.captured, 1)
+
+	var f []int16
+
+	select {
+	case f = <-c.free:
+	default:
+		f = make([]int16, c.size)
+	}
+
+	copy(f, samples)
+
+	select {
+	case c.frames <- f:
+	default:
+		atomic.AddUint64(&c.dropped, 1)
+		c.Release(f)
+	}
+}
+
+// Frames is where the frames arrive, interleaved if there are two
+// channels. It's closed when the Capture is.
+func (c *Capture) Frames() <-chan []int16 {
+	return c.frames
+}
+
+// Release hands a frame from Frames back to be reused. Frames that
+// aren't released are just garbage collected.
+func (c *Capture) Release(f []int16) {
+	select {
+	case c.free <- f:
+	default:
+	}
+}
+
+// Stats says how the capture has gone so far. It still works once the
+// Capture is closed.
+func (c *Capture) Stats() CaptureStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	s := CaptureStats{
+		Frames:    atomic.LoadUint64(&c.captured),
+		Dropped:   atomic.LoadUint64(&c.dropped),
+		Overflows: c.overflows,
+	}
+
+	if c.stream != nil {
+		s.Overflows = c.stream.Stats().InputOverflows
+	}
+
+	return s
+}
+
+func (c *Capture) SampleRate() int { return c.rate }
+func (c *Capture) Channels() int   { return c.channels }
+
+func (c *Capture) Read(buf []int16) (int, error) {
+	if len(c.cur) == 0 {
+		if c.hold != nil {
+			c.Release(c.hold)
+		}
+
+		f, ok := <-c.frames
+		if !ok {
+			c.hold = nil
+			return 0, io.EOF
+		}
+
+		c.cur, c.hold = f, f
+	}
+
+	n := copy(buf, c.cur)
+	c.cur = c.cur[n:]
+
+	return n, nil
+}
+
+// Flush drops the audio captured but not read yet, so that the next
+// Read gets what's captured from now on. Like Read, it's for the
+// reader to call.
+func (c *Capture) Flush() {
+	c.cur = nil
+
+	for {
+		select {
+		case f, ok := <-c.frames:
+			if !ok {
+				return
+			}
+
+			c.Release(f)
+		default:
+			return
+		}
+	}
+}
+
+// Close stops capturing. Frames still queued can be read before
+// Frames is closed. Closing it again does nothing.
+func (c *Capture) Close() error {
+	var err error
+
+	c.closed.Do(func() {
+		c.lock.Lock()
+
+		if c.stream != nil {
+			c.stream.Stop()
+			c.overflows = c.stream.Stats().InputOverflows
+			err = c.stream.Close()
+			c.stream = nil
+			portaudio.Terminate()
+		}
+
+		c.lock.Unlock()
+
+		close(c.frames)
+	})
+
+	return err
+}
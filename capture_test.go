@@ -0,0 +1,84 @@
+package alexa
+
+import (
+	"io"
+	"testing"
+)
+
+func TestCaptureFrames(t *testing.T) {
+	c := newCapture(16000, 1, 4)
+
+	// Uneven pieces come out as whole frames.
+	c.write([]int16{1, 2, 3})
+	c.write([]int16{4, 5, 6, 7, 8, 9})
+
+	for _, want := range [][]int16{{1, 2, 3, 4}, {5, 6, 7, 8}} {
+		f := <-c.Frames()
+
+		for i := range want {
+			if f[i] != want[i] {
+				t.Fatalf("got frame %v, want %v", f, want)
+			}
+		}
+
+		c.Release(f)
+	}
+
+	if s := c.Stats(); s.Frames != 2 || s.Dropped != 0 {
+		t.Errorf("got %+v, want 2 frames and none dropped", s)
+	}
+}
+
+func TestCaptureDropsWhenFull(t *testing.T) {
+	c := newCapture(16000, 1, 1)
+
+	for i := 0; i < captureQueue+3; i++ {
+		c.write([]int16{int16(i)})
+	}
+
+	if s := c.Stats(); s.Dropped != 3 || !s.Lost() {
+		t.Errorf("got %+v, want 3 frames dropped", s)
+	}
+}
+
+func TestCaptureCloseTwice(t *testing.T) {
+	c := newCapture(16000, 1, 2)
+	c.write([]int16{1, 2})
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// What was queued can still be read.
+	buf := make([]int16, 4)
+
+	n, err := c.Read(buf)
+	if n != 2 || err != nil || buf[0] != 1 || buf[1] != 2 {
+		t.Fatalf("got %v, %v, want [1 2]", buf[:n], err)
+	}
+
+	n, err = c.Read(buf)
+	if n != 0 || err != io.EOF {
+		t.Fatalf("got %d samples, %v, want io.EOF", n, err)
+	}
+}
+
+func TestCaptureStatsAfterClose(t *testing.T) {
+	c := newCapture(16000, 1, 1)
+	c.overflows = 2
+
+	for i := 0; i < captureQueue+1; i++ {
+		c.write([]int16{int16(i)})
+	}
+
+	c.Close()
+
+	s := c.Stats()
+	if s.Frames != captureQueue+1 || s.Dropped != 1 || s.Overflows != 2 {
+		t.Errorf("got %+v after Close, want what was counted before", s)
+	}
+}
@@ -0,0 +1,231 @@
+package alexa
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/avs"
+	"github.com/Fruchtgummi/alexa/config"
+	"github.com/Fruchtgummi/alexa/directives"
+)
+
+// TokenSource hands out access tokens for AVS.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// TokenFunc turns a plain function into a TokenSource.
+type TokenFunc func() (string, error)
+
+func (f TokenFunc) Token() (string, error) {
+	return f()
+}
+
+// ConfigTokens reads tokens from ~/.alexa.json, refreshing them as
+// needed.
+var ConfigTokens TokenSource = TokenFunc(config.GetToken)
+
+const DefaultLocale = "en-US"
+
+// Client talks to AVS on behalf of one device. It has no global state,
+// so several can be used side by side.
+type Client struct {
+	HTTPClient *http.Client
+	Tokens     TokenSource
+	Endpoint   string
+	Locale     string
+
+	// Context reports the state of the device with every event.
+	// Defaults to avs.DefaultContext.
+	Context func() []avs.State
+
+	lock       sync.Mutex
+	localeSent bool
+}
+
+// NewClient returns a Client for the default endpoint and locale.
+func NewClient(tokens TokenSource) *Client {
+	return &Client{
+		HTTPClient: http.DefaultClient,
+		Tokens:     tokens,
+		Endpoint:   avs.DefaultEndpoint,
+		Locale:     DefaultLocale,
+	}
+}
+
+// Response is what came back for a request.
+type Response struct {
+	*avs.Response
+
+	// DialogRequestId is the id the request was sent with. Directives
+	// that belong to it carry the same id.
+	DialogRequestId string
+
+	// FirstByte is when the first byte of the response arrived.
+	FirstByte time.Time
+}
+
+// Typed returns the directives that have a type in the directives
+// package, in order.
+func (r *Response) Typed() []directives.Directive {
+	var out []directives.Directive
+
+	for _, d := range r.Directives {
+		v, err := directives.Parse(d, r.Response)
+		if err == nil {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+
+	return c.HTTPClient
+}
+
+func (c *Client) endpoint() string {
+	if c.Endpoint == "" {
+		return avs.DefaultEndpoint
+	}
+
+	return c.Endpoint
+}
+
+func (c *Client) context() []avs.State {
+	if c.Context == nil {
+		return avs.DefaultContext()
+	}
+
+	return c.Context()
+}
+
+// withState returns states with s in place of the state of the same
+// name.
+func withState(states []avs.State, s avs.State) []avs.State {
+	for i := range states {
+		if states[i].Header.Namespace == s.Header.Namespace && states[i].Header.Name == s.Header.Name {
+			states[i] = s
+			return states
+		}
+	}
+
+	return append(states, s)
+}
+
+// Send sends ev along with audio, which may be nil.
+func (c *Client) Send(ctx context.Context, ev avs.Event, audio io.Reader) (*Response, error) {
+	token, err := c.Tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &avs.Message{
+		Context: c.context(),
+		Event:   ev,
+	}
+
+	var firstByte time.Time
+
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			firstByte = time.Now()
+		},
+	})
+
+	resp, err := avs.PostEvent(ctx, c.httpClient(), c.endpoint(), token, msg, audio)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Response:        resp,
+		DialogRequestId: ev.Header.DialogRequestId,
+		FirstByte:       firstByte,
+	}, nil
+}
+
+// Recognize streams audio, 16kHz mono L16, to AVS as a new dialog and
+// returns the response. Cancelling ctx aborts both the upload and the
+// read of the response.
+func (c *Client) Recognize(ctx context.Context, audio io.Reader) (*Response, error) {
+	return c.recognize(ctx, audio, nil)
+}
+
+// RecognizeExpected sends the user's answer to an ExpectSpeech
+// directive, handing back its initiator so AVS carries on with the
+// same dialog.
+func (c *Client) RecognizeExpected(ctx context.Context, audio io.Reader, initiator json.RawMessage) (*Response, error) {
+	return c.recognize(ctx, audio, initiator)
+}
+
+func (c *Client) recognize(ctx context.Context, audio io.Reader, initiator json.RawMessage) (*Response, error) {
+	err := c.updateLocale(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ev := avs.NewRecognizeEvent(avs.NewId())
+	ev.Payload = avs.RecognizePayload{
+		Profile:   avs.ProfileCloseTalking,
+		Format:    avs.AudioFormat,
+		Initiator: initiator,
+	}
+
+	return c.Send(ctx, ev, audio)
+}
+
+// Downchannel returns a downchannel for c, sharing its connection,
+// that hands the directives pushed down it to ds. It still has to be
+// started.
+func (c *Client) Downchannel(ds *directives.Dispatcher) *avs.Downchannel {
+	return &avs.Downchannel{
+		Client:   c.httpClient(),
+		Endpoint: c.endpoint(),
+		Token:    c.Tokens.Token,
+		Context:  c.context,
+		Directives: func(d *avs.Directive) {
+			ds.Dispatch(d, nil)
+		},
+	}
+}
+
+type setting struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// updateLocale tells AVS the locale before the first request.
+func (c *Client) updateLocale(ctx context.Context) error {
+	if c.Locale == "" {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.localeSent {
+		return nil
+	}
+
+	ev := avs.NewEvent("Settings", "SettingsUpdated", map[string][]setting{
+		"settings": {{Key: "locale", Value: c.Locale}},
+	})
+
+	_, err := c.Send(ctx, ev, nil)
+	if err != nil {
+		return err
+	}
+
+	c.localeSent = true
+	return nil
+}
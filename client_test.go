@@ -0,0 +1,48 @@
+package alexa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/avs/avstest"
+	"github.com/Fruchtgummi/alexa/directives"
+)
+
+func TestDownchannelDispatches(t *testing.T) {
+	var (
+		s       = &avstest.Server{}
+		c       = testClient(t, s)
+		ds      directives.Dispatcher
+		stopped = make(chan struct{}, 1)
+	)
+
+	ds.Handle("AudioPlayer", "Stop", func(directives.Directive) error {
+		stopped <- struct{}{}
+		return nil
+	})
+
+	dc := c.Downchannel(&ds)
+	dc.Start()
+
+	defer dc.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		if s.Push(avstest.Directive("AudioPlayer", "Stop", "", nil)) > 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("the downchannel never opened")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a pushed AudioPlayer.Stop never reached the dispatcher")
+	}
+}
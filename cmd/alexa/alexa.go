@@ -11,6 +11,11 @@ func main() {
 	parser.AddCommand("audio", "list audio devices", "", &alexa.AudioCommand{})
 	parser.AddCommand("setup", "start the setup procedure", "", &alexa.SetupCommand{})
 	parser.AddCommand("ask", "send alexa a question", "", &alexa.AskCommand{})
+	parser.AddCommand("listen", "listen for the wake word and answer questions", "", &alexa.ListenCommand{})
+	parser.AddCommand("enroll", "teach alexa your own wake word", "", &alexa.EnrollCommand{})
+	parser.AddCommand("vad-eval", "see how well speech is detected in labelled recordings", "", &alexa.VADEvalCommand{})
+	parser.AddCommand("alerts", "list the alarms, timers and reminders alexa has set", "", &alexa.AlertsCommand{})
+	parser.AddCommand("directives", "watch the downchannel for directives", "", &alexa.DirectivesCommand{})
 
 	parser.Parse()
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/Fruchtgummi/alexa/avs/avstest"
+	"github.com/jessevdk/go-flags"
+)
+
+var opts struct {
+	Addr     string `long:"addr" default:"localhost:5050" description:"address to listen on"`
+	Speech   string `long:"speech" description:"mp3 file to answer every question with"`
+	ReadRate int    `long:"read-rate" description:"bytes per second to read requests at, 32000 is real time"`
+}
+
+func main() {
+	_, err := flags.Parse(&opts)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	s := avstest.Server{ReadRate: opts.ReadRate}
+
+	if opts.Speech != "" {
+		s.Speech, err = ioutil.ReadFile(opts.Speech)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fmt.Printf("AVS stand-in on http://%s\n", opts.Addr)
+	log.Fatal(http.ListenAndServe(opts.Addr, s.Handler()))
+}
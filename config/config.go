@@ -18,6 +18,8 @@ type Config struct {
 	AccessToken  string    `json:"access_token"`
 	RefreshToken string    `json:"refresh_token"`
 	ExpiresAt    time.Time `json:"expires_at"`
+	InputDevice  string    `json:"input_device,omitempty"`
+	OutputDevice string    `json:"output_device,omitempty"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -0,0 +1,92 @@
+package alexa
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Fruchtgummi/alexa/avs"
+	"github.com/Fruchtgummi/alexa/directives"
+)
+
+// playbackCommands are the commands Controls sends to AVS, and the
+// PlaybackController events they send.
+var playbackCommands = map[string]string{
+	"n":        "NextCommandIssued",
+	"next":     "NextCommandIssued",
+	"p":        "PreviousCommandIssued",
+	"previous": "PreviousCommandIssued",
+	"pause":    "PauseCommandIssued",
+	"play":     "PlayCommandIssued",
+}
+
+// Controls reads commands from r, a line at a time, until ctx is done
+// or r runs out. "next" or "n", "previous" or "p", "pause" and "play"
+// go to AVS, and ds handles what comes back; "stop" stops an alert
+// going off.
+func Controls(ctx context.Context, c *Client, r io.Reader, ds *directives.Dispatcher, alerts *Alerts) error {
+	var (
+		lines   = make(chan string)
+		scanErr = make(chan error, 1)
+		done    = make(chan struct{})
+	)
+
+	defer close(done)
+
+	// The scanner goes on until its next line once Controls has
+	// returned, since a read can't be interrupted.
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			select {
+			case lines <- strings.TrimSpace(scanner.Text()):
+			case <-done:
+				return
+			}
+		}
+
+		scanErr <- scanner.Err()
+	}()
+
+	for {
+		var line string
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-scanErr:
+			return err
+		case line = <-lines:
+		}
+
+		line = strings.ToLower(line)
+
+		if line == "stop" {
+			if alerts == nil || !alerts.Stop() {
+				fmt.Fprintln(os.Stderr, "no alert to stop")
+			}
+
+			continue
+		}
+
+		name, ok := playbackCommands[line]
+		if !ok {
+			if line != "" {
+				fmt.Fprintf(os.Stderr, "unknown command %q, try next, previous, pause, play or stop\n", line)
+			}
+
+			continue
+		}
+
+		resp, err := c.Send(ctx, avs.NewEvent("PlaybackController", name, nil), nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			continue
+		}
+
+		ds.DispatchResponse(resp.Response)
+	}
+}
@@ -0,0 +1,42 @@
+package alexa
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestControlsLetsGoOfTheScanner(t *testing.T) {
+	var (
+		before      = runtime.NumGoroutine()
+		r, w        = io.Pipe()
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan error, 1)
+	)
+
+	defer w.Close()
+
+	go func() { done <- Controls(ctx, nil, r, nil, nil) }()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Controls went on after ctx was done")
+	}
+
+	// A line nobody's there to take any more.
+	io.WriteString(w, "next\n")
+
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > before; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left over", runtime.NumGoroutine()-before)
+		}
+	}
+}
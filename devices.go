@@ -0,0 +1,161 @@
+package alexa
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Fruchtgummi/alexa/config"
+	"github.com/Fruchtgummi/alexa/portaudio"
+)
+
+// FindDevice picks a device by the index `alexa audio` shows, its exact
+// name, or a piece of its name. An empty spec is the system default.
+// Only devices that can do input (or output) are considered.
+func FindDevice(spec string, input bool) (*portaudio.DeviceInfo, error) {
+	if spec == "" {
+		if input {
+			return portaudio.DefaultInputDevice()
+		}
+		return portaudio.DefaultOutputDevice()
+	}
+
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, err
+	}
+
+	return matchDevice(devices, spec, input)
+}
+
+// matchDevice is FindDevice picking from devices.
+func matchDevice(devices []*portaudio.DeviceInfo, spec string, input bool) (*portaudio.DeviceInfo, error) {
+	usable := func(d *portaudio.DeviceInfo) bool {
+		if input {
+			return d.MaxInputChannels > 0
+		}
+		return d.MaxOutputChannels > 0
+	}
+
+	kind := "output"
+	if input {
+		kind = "input"
+	}
+
+	if i, err := strconv.Atoi(spec); err == nil {
+		if i < 0 || i >= len(devices) {
+			return nil, fmt.Errorf("no device %d", i)
+		}
+
+		if !usable(devices[i]) {
+			return nil, fmt.Errorf("%s has no %s channels", devices[i].Name, kind)
+		}
+
+		return devices[i], nil
+	}
+
+	var matches []*portaudio.DeviceInfo
+
+	for _, d := range devices {
+		if !usable(d) {
+			continue
+		}
+
+		if d.Name == spec {
+			return d, nil
+		}
+
+		if strings.Contains(strings.ToLower(d.Name), strings.ToLower(spec)) {
+			matches = append(matches, d)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no %s device matches %q", kind, spec)
+	case 1:
+		return matches[0], nil
+	default:
+		var names []string
+		for _, d := range matches {
+			names = append(names, d.Name)
+		}
+
+		return nil, fmt.Errorf("%q matches several %s devices: %s", spec, kind, strings.Join(names, ", "))
+	}
+}
+
+// configuredDevices returns the devices to use: the ones given, or
+// else the ones saved with `alexa audio`.
+func configuredDevices(input, output string) (string, string, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return "", "", err
+	}
+
+	if input == "" {
+		input = cfg.InputDevice
+	}
+
+	if output == "" {
+		output = cfg.OutputDevice
+	}
+
+	return input, output, nil
+}
+
+// InputParameters are the parameters to capture from dev with: its own
+// rate, up to two channels and low latency.
+func InputParameters(dev *portaudio.DeviceInfo) portaudio.StreamParameters {
+	p := portaudio.LowLatencyParameters(dev, nil)
+
+	p.Input.Channels = dev.MaxInputChannels
+	if p.Input.Channels > 2 {
+		p.Input.Channels = 2
+	}
+
+	return p
+}
+
+// OutputParameters are the parameters to play to dev with. Playback
+// can afford to buffer, so it uses high latency.
+func OutputParameters(dev *portaudio.DeviceInfo) portaudio.StreamParameters {
+	return portaudio.HighLatencyParameters(nil, dev)
+}
+
+var standardRates = []float64{8000, 11025, 16000, 22050, 32000, 44100, 48000, 88200, 96000}
+
+// supportedRates returns which of the usual sample rates dev can do in
+// the given direction.
+func supportedRates(dev *portaudio.DeviceInfo, input bool) []float64 {
+	var (
+		p   portaudio.StreamParameters
+		buf = make([]int16, 1)
+	)
+
+	if input {
+		p = InputParameters(dev)
+	} else {
+		p = OutputParameters(dev)
+	}
+
+	return ratesWhere(p, func(p portaudio.StreamParameters) bool {
+		return portaudio.IsFormatSupported(p, buf) == nil
+	})
+}
+
+// ratesWhere returns the usual sample rates that p works at, as
+// supported says.
+func ratesWhere(p portaudio.StreamParameters, supported func(portaudio.StreamParameters) bool) []float64 {
+	var rates []float64
+
+	for _, rate := range standardRates {
+		p.SampleRate = rate
+
+		if supported(p) {
+			rates = append(rates, rate)
+		}
+	}
+
+	return rates
+}
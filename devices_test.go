@@ -0,0 +1,79 @@
+package alexa
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Fruchtgummi/alexa/portaudio"
+)
+
+var testDevices = []*portaudio.DeviceInfo{
+	{Name: "Built-in Microphone", MaxInputChannels: 2},
+	{Name: "Built-in Output", MaxOutputChannels: 2},
+	{Name: "USB Audio", MaxInputChannels: 1, MaxOutputChannels: 2},
+	{Name: "USB Audio Device", MaxInputChannels: 1},
+}
+
+func TestMatchDevice(t *testing.T) {
+	for _, c := range []struct {
+		spec  string
+		input bool
+
+		// want is the name of the device, or else a piece of the
+		// error.
+		want string
+		err  bool
+	}{
+		{spec: "0", input: true, want: "Built-in Microphone"},
+		{spec: "1", input: true, want: "has no input channels", err: true},
+		{spec: "4", input: true, want: "no device 4", err: true},
+		{spec: "-1", input: false, want: "no device -1", err: true},
+		{spec: "built-in", input: true, want: "Built-in Microphone"},
+		{spec: "built-in", input: false, want: "Built-in Output"},
+		{spec: "USB Audio", input: true, want: "USB Audio"},
+		{spec: "usb", input: true, want: "matches several input devices: USB Audio, USB Audio Device", err: true},
+		{spec: "usb", input: false, want: "USB Audio"},
+		{spec: "hdmi", input: false, want: `no output device matches "hdmi"`, err: true},
+	} {
+		dev, err := matchDevice(testDevices, c.spec, c.input)
+
+		switch {
+		case c.err && (err == nil || !strings.Contains(err.Error(), c.want)):
+			t.Errorf("%q input=%v: got %v, want an error saying %s", c.spec, c.input, err, c.want)
+		case !c.err && err != nil:
+			t.Errorf("%q input=%v: %s", c.spec, c.input, err)
+		case !c.err && dev.Name != c.want:
+			t.Errorf("%q input=%v: got %s, want %s", c.spec, c.input, dev.Name, c.want)
+		}
+	}
+}
+
+func TestSupportedRates(t *testing.T) {
+	var (
+		dev = testDevices[0]
+		p   = InputParameters(dev)
+	)
+
+	if p.Input.Channels != 2 {
+		t.Errorf("capturing %d channels from a stereo microphone", p.Input.Channels)
+	}
+
+	got := ratesWhere(p, func(p portaudio.StreamParameters) bool {
+		return p.Input.Device == dev && int(p.SampleRate)%16000 == 0
+	})
+
+	if fmt.Sprint(got) != "[16000 32000 48000 96000]" {
+		t.Errorf("got rates %v", got)
+	}
+
+	if s := rates(got); s != "16000 32000 48000 96000" {
+		t.Errorf("shown as %q", s)
+	}
+
+	none := ratesWhere(p, func(portaudio.StreamParameters) bool { return false })
+
+	if s := rates(none); s != "none" {
+		t.Errorf("no rates shown as %q, want none", s)
+	}
+}
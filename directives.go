@@ -0,0 +1,40 @@
+package alexa
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/Fruchtgummi/alexa/avs"
+)
+
+type DirectivesCommand struct {
+}
+
+func (d *DirectivesCommand) Execute(args []string) error {
+	c := Globals.Client()
+
+	dc := &avs.Downchannel{
+		Client:   c.HTTPClient,
+		Endpoint: c.Endpoint,
+		Token:    c.Tokens.Token,
+		Directives: func(d *avs.Directive) {
+			fmt.Printf("%s.%s %s\n", d.Header.Namespace, d.Header.Name, d.Payload)
+		},
+		Connected: func(n int) {
+			fmt.Printf("connected (#%d)\n", n)
+		},
+	}
+
+	dc.Start()
+	defer dc.Close()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, os.Kill)
+
+	defer signal.Reset(os.Interrupt, os.Kill)
+
+	<-sig
+
+	return nil
+}
@@ -0,0 +1,209 @@
+// Package directives has Go types for the directives AVS sends and a
+// Dispatcher that routes them to whoever handles them.
+package directives
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Fruchtgummi/alexa/avs"
+)
+
+// Directive is implemented by every typed directive. Header returns
+// the header it arrived with.
+type Directive interface {
+	Header() avs.Header
+}
+
+// Base is embedded in every typed directive to carry the header.
+type Base struct {
+	header avs.Header
+}
+
+func (b *Base) Header() avs.Header {
+	return b.header
+}
+
+func (b *Base) setHeader(h avs.Header) {
+	b.header = h
+}
+
+type Speak struct {
+	Base
+	URL    string `json:"url"`
+	Format string `json:"format"`
+	Token  string `json:"token"`
+
+	// Audio is the mp3 URL refers to, taken from the response the
+	// directive came in.
+	Audio []byte `json:"-"`
+}
+
+const (
+	ReplaceAll      = "REPLACE_ALL"
+	Enqueue         = "ENQUEUE"
+	ReplaceEnqueued = "REPLACE_ENQUEUED"
+
+	ClearEnqueued = "CLEAR_ENQUEUED"
+	ClearAll      = "CLEAR_ALL"
+)
+
+type ProgressReport struct {
+	DelayInMilliseconds    int64 `json:"progressReportDelayInMilliseconds"`
+	IntervalInMilliseconds int64 `json:"progressReportIntervalInMilliseconds"`
+}
+
+type Stream struct {
+	URL                   string         `json:"url"`
+	StreamFormat          string         `json:"streamFormat"`
+	OffsetInMilliseconds  int64          `json:"offsetInMilliseconds"`
+	ExpiryTime            string         `json:"expiryTime"`
+	ProgressReport        ProgressReport `json:"progressReport"`
+	Token                 string         `json:"token"`
+	ExpectedPreviousToken string         `json:"expectedPreviousToken"`
+
+	// Audio is set when URL is a "cid:" and the content came along
+	// with the directive.
+	Audio []byte `json:"-"`
+}
+
+type AudioItem struct {
+	AudioItemId string `json:"audioItemId"`
+	Stream      Stream `json:"stream"`
+}
+
+type Play struct {
+	Base
+	PlayBehavior string    `json:"playBehavior"`
+	AudioItem    AudioItem `json:"audioItem"`
+}
+
+type Stop struct {
+	Base
+}
+
+type ClearQueue struct {
+	Base
+	ClearBehavior string `json:"clearBehavior"`
+}
+
+type SetVolume struct {
+	Base
+	Volume int64 `json:"volume"`
+}
+
+// AdjustVolume changes the volume by Volume, which may be negative.
+type AdjustVolume struct {
+	Base
+	Volume int64 `json:"volume"`
+}
+
+type SetMute struct {
+	Base
+	Mute bool `json:"mute"`
+}
+
+// ExpectSpeech asks for the user's answer to what was just said. The
+// Initiator, if any, goes back with the Recognize carrying the answer.
+type ExpectSpeech struct {
+	Base
+	TimeoutInMilliseconds int64           `json:"timeoutInMilliseconds"`
+	Initiator             json.RawMessage `json:"initiator,omitempty"`
+}
+
+type StopCapture struct {
+	Base
+}
+
+const (
+	AlertTimer    = "TIMER"
+	AlertAlarm    = "ALARM"
+	AlertReminder = "REMINDER"
+)
+
+type SetAlert struct {
+	Base
+	Token         string `json:"token"`
+	Type          string `json:"type"`
+	ScheduledTime string `json:"scheduledTime"`
+}
+
+type DeleteAlert struct {
+	Base
+	Token string `json:"token"`
+}
+
+type ResetUserInactivity struct {
+	Base
+}
+
+var registry = map[string]func() Directive{
+	"SpeechSynthesizer.Speak":       func() Directive { return new(Speak) },
+	"AudioPlayer.Play":              func() Directive { return new(Play) },
+	"AudioPlayer.Stop":              func() Directive { return new(Stop) },
+	"AudioPlayer.ClearQueue":        func() Directive { return new(ClearQueue) },
+	"Speaker.SetVolume":             func() Directive { return new(SetVolume) },
+	"Speaker.AdjustVolume":          func() Directive { return new(AdjustVolume) },
+	"Speaker.SetMute":               func() Directive { return new(SetMute) },
+	"SpeechRecognizer.ExpectSpeech": func() Directive { return new(ExpectSpeech) },
+	"SpeechRecognizer.StopCapture":  func() Directive { return new(StopCapture) },
+	"Alerts.SetAlert":               func() Directive { return new(SetAlert) },
+	"Alerts.DeleteAlert":            func() Directive { return new(DeleteAlert) },
+	"System.ResetUserInactivity":    func() Directive { return new(ResetUserInactivity) },
+}
+
+// ErrUnknown is returned by Parse for a directive there's no type for.
+type ErrUnknown struct {
+	Namespace, Name string
+}
+
+func (e *ErrUnknown) Error() string {
+	return fmt.Sprintf("unknown directive %s.%s", e.Namespace, e.Name)
+}
+
+// Parse turns d into its typed form. Content it refers to with a
+// "cid:" url is looked up in resp, which may be nil for directives
+// that came down the downchannel.
+func Parse(d *avs.Directive, resp *avs.Response) (Directive, error) {
+	mk, ok := registry[d.Header.Namespace+"."+d.Header.Name]
+	if !ok {
+		return nil, &ErrUnknown{d.Header.Namespace, d.Header.Name}
+	}
+
+	v := mk()
+
+	err := d.Decode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	v.(interface {
+		setHeader(avs.Header)
+	}).setHeader(d.Header)
+
+	switch v := v.(type) {
+	case *Speak:
+		v.Audio, err = content(resp, v.URL)
+	case *Play:
+		if strings.HasPrefix(v.AudioItem.Stream.URL, "cid:") {
+			v.AudioItem.Stream.Audio, err = content(resp, v.AudioItem.Stream.URL)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func content(resp *avs.Response, url string) ([]byte, error) {
+	if resp != nil {
+		if data, ok := resp.Content(url); ok {
+			return data, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no content for %s", url)
+}
@@ -0,0 +1,109 @@
+package directives
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/Fruchtgummi/alexa/avs"
+)
+
+// Handler does whatever a directive asks for.
+type Handler func(Directive) error
+
+const (
+	UnexpectedInformation = "UNEXPECTED_INFORMATION_RECEIVED"
+	UnsupportedOperation  = "UNSUPPORTED_OPERATION"
+	InternalError         = "INTERNAL_ERROR"
+)
+
+// Dispatcher routes directives to the handler registered for their
+// namespace and name. Directives nobody handles, can't be parsed or
+// whose handler fails are reported back to AVS with a
+// System.ExceptionEncountered event rather than dropped. A handler
+// that has reported a failure of its own, like Alerts.SetAlertFailed,
+// returns nil so it isn't reported twice.
+type Dispatcher struct {
+	// Report is given the events the dispatcher produces itself, to
+	// send on to AVS.
+	Report func(avs.Event)
+
+	lock     sync.Mutex
+	handlers map[string]Handler
+}
+
+// Handle registers h for namespace.name.
+func (ds *Dispatcher) Handle(namespace, name string, h Handler) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if ds.handlers == nil {
+		ds.handlers = make(map[string]Handler)
+	}
+
+	ds.handlers[namespace+"."+name] = h
+}
+
+func (ds *Dispatcher) handler(h avs.Header) Handler {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	return ds.handlers[h.Namespace+"."+h.Name]
+}
+
+// Dispatch parses d and runs its handler. resp is where "cid:" content
+// is looked up and may be nil.
+func (ds *Dispatcher) Dispatch(d *avs.Directive, resp *avs.Response) {
+	h := ds.handler(d.Header)
+	if h == nil {
+		ds.exception(d, UnsupportedOperation, "unsupported directive "+d.Header.Namespace+"."+d.Header.Name)
+		return
+	}
+
+	v, err := Parse(d, resp)
+	if err != nil {
+		ds.exception(d, UnexpectedInformation, err.Error())
+		return
+	}
+
+	err = h(v)
+	if err != nil {
+		ds.exception(d, InternalError, err.Error())
+	}
+}
+
+// DispatchResponse dispatches every directive in resp, in order.
+func (ds *Dispatcher) DispatchResponse(resp *avs.Response) {
+	for _, d := range resp.Directives {
+		ds.Dispatch(d, resp)
+	}
+}
+
+type exceptionError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type ExceptionEncountered struct {
+	UnparsedDirective string         `json:"unparsedDirective"`
+	Error             exceptionError `json:"error"`
+}
+
+func (ds *Dispatcher) exception(d *avs.Directive, typ, message string) {
+	if ds.Report == nil {
+		log.Printf("directives: %s.%s: %s", d.Header.Namespace, d.Header.Name, message)
+		return
+	}
+
+	raw, _ := json.Marshal(struct {
+		Directive *avs.Directive `json:"directive"`
+	}{d})
+
+	ds.Report(avs.NewEvent("System", "ExceptionEncountered", ExceptionEncountered{
+		UnparsedDirective: string(raw),
+		Error: exceptionError{
+			Type:    typ,
+			Message: message,
+		},
+	}))
+}
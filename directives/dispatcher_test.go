@@ -0,0 +1,91 @@
+package directives_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Fruchtgummi/alexa/avs"
+	"github.com/Fruchtgummi/alexa/avs/avstest"
+	"github.com/Fruchtgummi/alexa/directives"
+)
+
+// exceptions dispatches resp and returns the error types of the
+// ExceptionEncountered events it produced.
+func exceptions(t *testing.T, ds *directives.Dispatcher, resp *avs.Response) []string {
+	var types []string
+
+	ds.Report = func(ev avs.Event) {
+		if ev.Header.Namespace != "System" || ev.Header.Name != "ExceptionEncountered" {
+			t.Fatalf("dispatcher reported %s.%s", ev.Header.Namespace, ev.Header.Name)
+		}
+
+		types = append(types, ev.Payload.(directives.ExceptionEncountered).Error.Type)
+	}
+
+	ds.DispatchResponse(resp)
+
+	return types
+}
+
+func TestDispatchResolvesContent(t *testing.T) {
+	var (
+		reply = avstest.Speak("dialog", []byte("mp3"))
+		resp  = &avs.Response{Directives: reply.Directives, Audio: reply.Audio}
+		ds    directives.Dispatcher
+		audio []byte
+	)
+
+	ds.Handle("SpeechSynthesizer", "Speak", func(d directives.Directive) error {
+		if h := d.Header(); h.Name != "Speak" || h.DialogRequestId != "dialog" {
+			t.Errorf("Speak arrived with header %+v", h)
+		}
+
+		audio = d.(*directives.Speak).Audio
+		return nil
+	})
+
+	if ex := exceptions(t, &ds, resp); len(ex) != 0 {
+		t.Errorf("got exceptions %v", ex)
+	}
+
+	if string(audio) != "mp3" {
+		t.Errorf("Speak has audio %q, want %q", audio, "mp3")
+	}
+}
+
+func TestDispatchExceptions(t *testing.T) {
+	var ds directives.Dispatcher
+
+	ds.Handle("Alerts", "DeleteAlert", func(directives.Directive) error {
+		return errors.New("broken")
+	})
+
+	ds.Handle("Speaker", "SetVolume", func(directives.Directive) error {
+		return nil
+	})
+
+	resp := &avs.Response{
+		Directives: []*avs.Directive{
+			avstest.Directive("Made", "Up", "", nil),
+			avstest.Directive("Alerts", "DeleteAlert", "", map[string]string{"token": "alarm"}),
+			{
+				Header:  avs.Header{Namespace: "Speaker", Name: "SetVolume"},
+				Payload: json.RawMessage(`{"volume": "loud"}`),
+			},
+		},
+	}
+
+	got := exceptions(t, &ds, resp)
+	want := []string{directives.UnsupportedOperation, directives.InternalError, directives.UnexpectedInformation}
+
+	if len(got) != len(want) {
+		t.Fatalf("got exceptions %v, want %v", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("exception %d is %s, want %s", i, got[i], want[i])
+		}
+	}
+}
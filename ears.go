@@ -2,115 +2,267 @@ package alexa
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
-	"os"
-	"os/signal"
+	"errors"
+	"io"
 	"time"
-
-	"github.com/Fruchtgummi/alexa/portaudio"
 )
 
 const DefaultQuietTime = time.Second
 
-func ListenIntoBuffer(opts ListenOpts) (*bytes.Buffer, error) {
-	portaudio.Initialize()
-	defer portaudio.Terminate()
+// DefaultPreRoll is how much audio from before the speech started is
+// sent with it.
+const DefaultPreRoll = 500 * time.Millisecond
+
+// DefaultTrailingSilence is how much of the quiet after the speech is
+// sent with it.
+const DefaultTrailingSilence = 300 * time.Millisecond
+
+// ListenFrame is how many samples are captured, sent and looked at for
+// speech at a time, 20ms.
+const ListenFrame = 320
 
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt, os.Kill)
+var (
+	// ErrNoSpeech is returned when nobody started talking within
+	// ListenOpts.MaxInitialSilence or before ListenOpts.Deadline, or
+	// before the source ran out. Nothing has been written then.
+	ErrNoSpeech = errors.New("no speech heard")
+
+	// ErrUtteranceTooLong is returned when the speech went on for more
+	// than ListenOpts.MaxUtterance or past ListenOpts.Deadline.
+	ErrUtteranceTooLong = errors.New("utterance too long")
+)
 
-	defer signal.Reset(os.Interrupt, os.Kill)
+func ListenIntoBuffer(ctx context.Context, opts ListenOpts) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
 
-	in := make([]int16, 8196)
-	stream, err := portaudio.OpenDefaultStream(1, 0, 16000, len(in), in)
+	err := ListenInto(ctx, &buf, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	defer stream.Close()
+	return &buf, nil
+}
 
-	err = stream.Start()
-	if err != nil {
-		return nil, err
+// ListenInto writes the utterance to w as it's being captured, so
+// that w can already be sending it on while the user is still
+// talking. It stops early, with an error, when ctx is done or one of
+// the limits in opts is reached.
+func ListenInto(ctx context.Context, w io.Writer, opts ListenOpts) error {
+	src := opts.Source
+	if src == nil {
+		mic, err := OpenCapture(opts.InputDevice, 0)
+		if err != nil {
+			return err
+		}
+
+		defer mic.Close()
+
+		src = mic
+	}
+
+	lossy := captureStats(src)
+
+	var lost CaptureStats
+	if lossy != nil {
+		lost = lossy()
+	}
+
+	src = NewL16Source(src)
+
+	detector := opts.Detector
+	if detector == nil {
+		detector = NewFluxDetector()
+	}
+
+	detector.Reset()
+
+	ep := opts.Endpointer
+	if ep == nil {
+		ep = &Endpointer{}
+	}
+
+	ep.StartDuration = opts.StartDuration
+	ep.Hangover = opts.Hangover
+	ep.QuietDuration = opts.QuietDuration
+	ep.SampleRate = src.SampleRate()
+	ep.Reset()
+
+	preRoll := opts.PreRoll
+	if preRoll == 0 {
+		preRoll = DefaultPreRoll
+	}
+
+	trailing := opts.TrailingSilence
+	if trailing == 0 {
+		trailing = DefaultTrailingSilence
+	}
+
+	samples := func(d time.Duration) int {
+		return int(d * time.Duration(src.SampleRate()) / time.Second)
 	}
 
 	var (
-		buf            bytes.Buffer
-		heardSomething bool
-		quiet          bool
-		quietTime      = opts.QuietDuration
-		quietStart     time.Time
-		lastFlux       float64
+		in         = make([]int16, ListenFrame)
+		ring       = NewRing(samples(preRoll) + delay(detector))
+		pre        = make([]int16, ring.Cap())
+		held       []int16
+		quiet      int
+		quietLimit = samples(trailing)
 	)
 
-	vad := NewVAD(len(in))
+	send := func(samples []int16) error {
+		err := binary.Write(w, binary.LittleEndian, samples)
+		if err != nil {
+			return err
+		}
 
-	if quietTime == 0 {
-		quietTime = DefaultQuietTime
+		if opts.Record != nil {
+			return opts.Record.WriteInt16(samples)
+		}
+
+		return nil
 	}
 
+	var (
+		maxWait   = samples(opts.MaxInitialSilence)
+		maxLength = samples(opts.MaxUtterance)
+		waited    int
+		spoken    int
+	)
+
 	if opts.State != nil {
 		opts.State(Waiting)
 	}
 
 reader:
 	for {
-		err = stream.Read()
-		if err != nil {
-			return nil, err
+		err := readFull(src, in)
+		if err == io.EOF {
+			break reader
 		}
 
-		err = binary.Write(&buf, binary.LittleEndian, in)
-		if err != nil {
-			return nil, err
+		last := err == io.ErrUnexpectedEOF
+
+		if err != nil && !last {
+			return err
+		}
+
+		err = nil
+
+		if lossy != nil && opts.Lost != nil {
+			if stats := lossy(); stats.Dropped != lost.Dropped || stats.Overflows != lost.Overflows {
+				lost = stats
+				opts.Lost(stats)
+			}
 		}
 
-		flux := vad.Flux(in)
+		end := NoChange
+
+		if !last {
+			end = ep.Push(detector.Detect(in), in)
 
-		if lastFlux == 0 {
-			lastFlux = flux
-			continue
+			if opts.Noise != nil {
+				opts.Noise(ep.Floor(), ep.SNR())
+			}
 		}
 
-		if heardSomething {
-			if flux*1.75 <= lastFlux {
-				if !quiet {
-					quietStart = time.Now()
-				} else {
-					diff := time.Since(quietStart)
-
-					if diff > quietTime {
-						break reader
-					}
-				}
-
-				quiet = true
-			} else {
-				quiet = false
-				lastFlux = flux
+		switch {
+		case !ep.Started():
+			// Keep the audio from just before the speech starts, so
+			// the start of the first word isn't lost.
+			ring.Write(in)
+		case end == SpeechStarted:
+			ring.Write(in)
+
+			err = send(pre[:ring.Read(pre)])
+
+			if opts.State != nil {
+				opts.State(Listening)
 			}
+		case ep.Speech():
+			err = send(held)
+			if err == nil {
+				err = send(in)
+			}
+
+			held = held[:0]
+			quiet = 0
+		case quiet < quietLimit:
+			err = send(in)
+			quiet += len(in)
+		default:
+			// Hold on to quiet past the trailing silence; it's only
+			// sent if the user carries on talking.
+			held = append(held, in...)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if last || end == SpeechEnded {
+			break reader
+		}
+
+		if ep.Started() {
+			spoken += len(in)
 		} else {
-			if flux >= lastFlux*1.75 {
-				heardSomething = true
-				if opts.State != nil {
-					opts.State(Listening)
-				}
+			waited += len(in)
+		}
+
+		switch {
+		case !ep.Started() && maxWait > 0 && waited >= maxWait:
+			return ErrNoSpeech
+		case ep.Started() && maxLength > 0 && spoken > maxLength:
+			return ErrUtteranceTooLong
+		case !opts.Deadline.IsZero() && time.Now().After(opts.Deadline):
+			if ep.Started() {
+				return ErrUtteranceTooLong
 			}
 
-			lastFlux = flux
+			return ErrNoSpeech
 		}
 
 		select {
-		case <-sig:
-			break reader
+		case <-ctx.Done():
+			return ctx.Err()
 		default:
 		}
 	}
 
-	err = stream.Stop()
-	if err != nil {
-		return nil, err
+	// The pre-roll is only sent once there's speech to go with it.
+	if !ep.Started() {
+		return ErrNoSpeech
 	}
 
-	return &buf, nil
+	return nil
+}
+
+// captureStats finds the stats of whatever can lose audio under src,
+// if anything.
+func captureStats(src AudioSource) func() CaptureStats {
+	for {
+		switch s := src.(type) {
+		case interface{ Stats() CaptureStats }:
+			return s.Stats
+		case *l16Source:
+			src = s.src
+		case *prerolledSource:
+			src = s.AudioSource
+		default:
+			return nil
+		}
+	}
+}
+
+// delay is how many samples late the detector makes up its mind, if
+// it says.
+func delay(d VoiceDetector) int {
+	if d, ok := d.(interface{ Delay() int }); ok {
+		return d.Delay()
+	}
+
+	return 0
 }
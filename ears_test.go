@@ -0,0 +1,174 @@
+package alexa
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// heard decodes what ListenInto wrote.
+func heard(b *bytes.Buffer) []int16 {
+	out := make([]int16, b.Len()/2)
+	binary.Read(bytes.NewReader(b.Bytes()), binary.LittleEndian, out)
+
+	return out
+}
+
+// loudest is where the first and last samples louder than level are.
+func loudest(samples []int16, level int16) (first, last int) {
+	first, last = -1, -1
+
+	for i, s := range samples {
+		if s > level || s < -level {
+			if first < 0 {
+				first = i
+			}
+
+			last = i
+		}
+	}
+
+	return first, last
+}
+
+func TestListenPreRollAndTail(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := ListenInto(context.Background(), &buf, ListenOpts{
+		Detector: NewEnergyDetector(),
+		Source:   NewGeneratorSource(16000, Noise(0.002, 2*time.Second), burst(0.002, time.Second), Noise(0.002, 3*time.Second)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		out         = heard(&buf)
+		first, last = loudest(out, 3000)
+		lead        = time.Duration(first) * time.Second / 16000
+		tail        = time.Duration(len(out)-last) * time.Second / 16000
+	)
+
+	if lead < DefaultPreRoll-40*time.Millisecond || lead > DefaultPreRoll+20*time.Millisecond {
+		t.Errorf("%s sent from before the speech, want %s", lead, DefaultPreRoll)
+	}
+
+	if tail < DefaultTrailingSilence-20*time.Millisecond || tail > DefaultTrailingSilence+20*time.Millisecond {
+		t.Errorf("%s sent from after the speech, want %s", tail, DefaultTrailingSilence)
+	}
+}
+
+func TestListenNoSpeechSendsNothing(t *testing.T) {
+	var buf bytes.Buffer
+
+	// Not a whole number of frames, so the last one is padded.
+	err := ListenInto(context.Background(), &buf, ListenOpts{
+		Detector: NewEnergyDetector(),
+		Source:   NewGeneratorSource(16000, Noise(0.002, 2005*time.Millisecond)),
+	})
+	if err != ErrNoSpeech {
+		t.Fatalf("got %v, want ErrNoSpeech", err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes sent with no speech", buf.Len())
+	}
+}
+
+// pacedSource takes a while over every read, like a microphone.
+type pacedSource struct {
+	AudioSource
+	pace time.Duration
+}
+
+func (s *pacedSource) Read(buf []int16) (int, error) {
+	time.Sleep(s.pace)
+	return s.AudioSource.Read(buf)
+}
+
+// cancellingSource calls cancel once after samples have been read.
+type cancellingSource struct {
+	AudioSource
+	samples int
+	cancel  func()
+}
+
+func (s *cancellingSource) Read(buf []int16) (int, error) {
+	n, err := s.AudioSource.Read(buf)
+
+	s.samples -= n
+	if s.samples <= 0 && s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+
+	return n, err
+}
+
+func TestListenLimits(t *testing.T) {
+	talking := func() AudioSource {
+		return NewGeneratorSource(16000, Noise(0.002, time.Second), burst(0.002, 5*time.Second), Noise(0.002, 2*time.Second))
+	}
+
+	for _, c := range []struct {
+		name string
+		opts ListenOpts
+		ctx  func(AudioSource) (context.Context, AudioSource)
+		want error
+
+		// deadline is how long from the start the Deadline is.
+		deadline time.Duration
+	}{{
+		name: "talking too long",
+		opts: ListenOpts{Source: talking(), MaxUtterance: 2 * time.Second},
+		want: ErrUtteranceTooLong,
+	}, {
+		name: "long enough",
+		opts: ListenOpts{Source: talking(), MaxUtterance: 6 * time.Second},
+	}, {
+		name: "nobody talking",
+		opts: ListenOpts{Source: NewGeneratorSource(16000, Noise(0.002, 5*time.Second), burst(0.002, time.Second)), MaxInitialSilence: 2 * time.Second},
+		want: ErrNoSpeech,
+	}, {
+		name:     "deadline before talking",
+		opts:     ListenOpts{Source: talking()},
+		deadline: time.Nanosecond,
+		want:     ErrNoSpeech,
+	}, {
+		// The talking starts about half a second in.
+		name:     "deadline while talking",
+		opts:     ListenOpts{Source: &pacedSource{talking(), 10 * time.Millisecond}},
+		deadline: 1500 * time.Millisecond,
+		want:     ErrUtteranceTooLong,
+	}, {
+		name: "cancelled while talking",
+		opts: ListenOpts{Source: talking()},
+		ctx: func(src AudioSource) (context.Context, AudioSource) {
+			ctx, cancel := context.WithCancel(context.Background())
+			return ctx, &cancellingSource{src, 3 * 16000, cancel}
+		},
+		want: context.Canceled,
+	}} {
+		var (
+			ctx = context.Background()
+			buf bytes.Buffer
+		)
+
+		if c.ctx != nil {
+			ctx, c.opts.Source = c.ctx(c.opts.Source)
+		}
+
+		if c.deadline != 0 {
+			c.opts.Deadline = time.Now().Add(c.deadline)
+		}
+
+		c.opts.Detector = NewEnergyDetector()
+
+		err := ListenInto(ctx, &buf, c.opts)
+		if err != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package alexa
+
+import "time"
+
+// Endpoint is what an Endpointer makes of a frame.
+type Endpoint int
+
+const (
+	// NoChange means the user is still quiet, or still talking.
+	NoChange Endpoint = iota
+
+	// SpeechStarted means the user has started talking.
+	SpeechStarted
+
+	// SpeechEnded means the user has stopped talking for long enough
+	// to have finished.
+	SpeechEnded
+)
+
+// DefaultStartSNR and DefaultStopSNR are how far above the noise floor,
+// in dB, speech has to be to start an utterance and to keep it going.
+const (
+	DefaultStartSNR = 9
+	DefaultStopSNR  = 4
+)
+
+// Endpointer turns a VoiceDetector's frame by frame speech
+// probabilities into when an utterance starts and ends. It keeps track
+// of the noise floor too, and only believes the detector about frames
+// that stand out from it enough.
+type Endpointer struct {
+	// Threshold is the probability above which a frame is speech. Zero
+	// means 0.5.
+	Threshold float64
+
+	// StartDuration is how much speech in a row it takes to decide the
+	// user has started talking.
+	StartDuration time.Duration
+
+	// Hangover is how long the user still counts as talking after the
+	// last frame of speech, to bridge the gaps between words.
+	Hangover time.Duration
+
+	// QuietDuration is how much quiet after the hangover ends the
+	// utterance. Zero means DefaultQuietTime.
+	QuietDuration time.Duration
+
+	// StartSNR is how many dB above the noise floor a frame must be to
+	// start an utterance, and StopSNR to keep one going. Zero means
+	// DefaultStartSNR and DefaultStopSNR, below zero turns them off.
+	StartSNR float64
+	StopSNR  float64
+
+	// SampleRate is what the frames are counted in. Zero means 16kHz.
+	SampleRate int
+
+	// Noise tracks the noise floor; its Window and SampleRate can be
+	// set, the rest is kept up to date by Push.
+	Noise NoiseFloor
+
+	started bool
+	speech  int
+	quiet   int
+	snr     float64
+	last    bool
+}
+
+func (e *Endpointer) samples(d time.Duration) int {
+	rate := e.SampleRate
+	if rate == 0 {
+		rate = 16000
+	}
+
+	return int(d * time.Duration(rate) / time.Second)
+}
+
+// Started reports whether the user has started talking.
+func (e *Endpointer) Started() bool {
+	return e.started
+}
+
+// Speech reports whether the last frame counted as speech.
+func (e *Endpointer) Speech() bool {
+	return e.last
+}
+
+// Floor is the noise floor in dB.
+func (e *Endpointer) Floor() float64 {
+	return e.Noise.Level()
+}
+
+// SNR is how far above the noise floor the last frame was, in dB.
+func (e *Endpointer) SNR() float64 {
+	return e.snr
+}
+
+func orDefault(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+
+	return v
+}
+
+// Push takes the next frame and the detector's speech probability for
+// it.
+func (e *Endpointer) Push(p float64, frame []int16) Endpoint {
+	n := len(frame)
+
+	if e.Noise.SampleRate == 0 {
+		e.Noise.SampleRate = e.SampleRate
+	}
+
+	db := decibels(frame)
+	e.snr = db - e.Noise.Update(db, n)
+
+	minSNR := orDefault(e.StopSNR, DefaultStopSNR)
+	if !e.started {
+		minSNR = orDefault(e.StartSNR, DefaultStartSNR)
+	}
+
+	speech := p > orDefault(e.Threshold, 0.5) && (minSNR < 0 || e.snr >= minSNR)
+	e.last = speech
+
+	if !e.started {
+		if !speech {
+			e.speech = 0
+			return NoChange
+		}
+
+		e.speech += n
+
+		if e.speech < e.samples(e.StartDuration) {
+			return NoChange
+		}
+
+		e.started = true
+		e.quiet = 0
+
+		return SpeechStarted
+	}
+
+	if speech {
+		e.quiet = 0
+		return NoChange
+	}
+
+	e.quiet += n
+
+	quiet := e.QuietDuration
+	if quiet == 0 {
+		quiet = DefaultQuietTime
+	}
+
+	if e.quiet > e.samples(e.Hangover+quiet) {
+		return SpeechEnded
+	}
+
+	return NoChange
+}
+
+// Reset gets ready for the next utterance, keeping the noise floor.
+func (e *Endpointer) Reset() {
+	e.started = false
+	e.speech = 0
+	e.quiet = 0
+	e.last = false
+}
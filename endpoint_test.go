@@ -0,0 +1,127 @@
+package alexa
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// burst is someone saying something for d over a background of noise.
+func burst(noise float64, d time.Duration) Segment {
+	return Segment{Duration: d, Frequency: 150, Amplitude: 0.3, Voiced: true, Noise: noise}
+}
+
+// endpoints runs samples through ep a frame at a time and returns when
+// the speech started and ended, or -1 for never.
+func endpoints(ep *Endpointer, samples []int16) (start, end time.Duration) {
+	var (
+		d   = NewEnergyDetector()
+		pos int
+	)
+
+	start, end = -1, -1
+
+	for ; pos+ListenFrame <= len(samples); pos += ListenFrame {
+		frame := samples[pos : pos+ListenFrame]
+		at := time.Duration(pos) * time.Second / 16000
+
+		switch ep.Push(d.Detect(frame), frame) {
+		case SpeechStarted:
+			start = at
+		case SpeechEnded:
+			if end < 0 {
+				end = at
+			}
+		}
+	}
+
+	return start, end
+}
+
+func TestEndpointerBursts(t *testing.T) {
+	// Quiet room, fan, TV in the background.
+	for _, noise := range []float64{0.002, 0.02, 0.06} {
+		ep := &Endpointer{StartDuration: 60 * time.Millisecond}
+
+		start, end := endpoints(ep, generate(
+			Noise(noise, 6*time.Second),
+			burst(noise, time.Second),
+			Noise(noise, 3*time.Second),
+		))
+
+		if start < 6*time.Second || start > 6300*time.Millisecond {
+			t.Errorf("noise %g: speech at 6s started at %v", noise, start)
+		}
+
+		if end < 7*time.Second || end > 8500*time.Millisecond {
+			t.Errorf("noise %g: speech until 7s ended at %v", noise, end)
+		}
+	}
+}
+
+func TestEndpointerNoiseAlone(t *testing.T) {
+	for _, noise := range []float64{0.002, 0.02, 0.06} {
+		start, _ := endpoints(&Endpointer{}, generate(Noise(noise, 8*time.Second)))
+
+		if start >= 0 {
+			t.Errorf("noise %g taken for speech at %v", noise, start)
+		}
+	}
+}
+
+func TestEndpointerSpeechFromTheStart(t *testing.T) {
+	ep := &Endpointer{StartDuration: 60 * time.Millisecond}
+
+	start, end := endpoints(ep, generate(
+		burst(0.002, time.Second),
+		Noise(0.002, 3*time.Second),
+	))
+
+	if start < 0 || start > 300*time.Millisecond {
+		t.Errorf("speech from the start started at %v", start)
+	}
+
+	if end < time.Second || end > 2500*time.Millisecond {
+		t.Errorf("speech until 1s ended at %v", end)
+	}
+}
+
+func TestListenKeepsNoiseFloor(t *testing.T) {
+	var (
+		ep   = &Endpointer{}
+		fan  = Noise(0.02, 6*time.Second)
+		said = burst(0.02, time.Second)
+	)
+
+	err := ListenInto(context.Background(), ioutil.Discard, ListenOpts{
+		Detector:   NewEnergyDetector(),
+		Endpointer: ep,
+		Source:     NewGeneratorSource(16000, fan, said, Noise(0.02, 2*time.Second)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	learnt := ep.Floor()
+
+	var first float64
+
+	err = ListenInto(context.Background(), ioutil.Discard, ListenOpts{
+		Detector:   NewEnergyDetector(),
+		Endpointer: ep,
+		Source:     NewGeneratorSource(16000, said, Noise(0.02, 2*time.Second)),
+		Noise: func(floor, snr float64) {
+			if first == 0 {
+				first = floor
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if learnt < -40 || first < learnt-3 {
+		t.Errorf("noise floor was %.1fdB after the first question, %.1fdB going into the second", learnt, first)
+	}
+}
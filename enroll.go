@@ -0,0 +1,383 @@
+package alexa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/features"
+	"github.com/fatih/color"
+)
+
+// WakeWordPath is where enrolled wake word templates are kept, next to
+// the config.
+func WakeWordPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".alexa-wakeword.json")
+}
+
+// WakeWord is a wake word enrolled from a few recordings of the user
+// saying it.
+type WakeWord struct {
+	// Threshold is the highest DTW score that still counts as the
+	// wake word.
+	Threshold float64 `json:"threshold"`
+
+	// Templates are the MFCC sequences of each recording.
+	Templates [][][]float64 `json:"templates"`
+}
+
+var ErrTooShort = errors.New("recording is too short to be a wake word")
+
+// minTemplate is the fewest frames a template can have, 200ms.
+const minTemplate = 20
+
+// thresholdMargin is how much worse than the enrollment recordings
+// match each other a match may be.
+const thresholdMargin = 1.2
+
+// wakeWordFeatures is the MFCCs of the samples without c0, which only
+// tracks loudness, and with the mean taken out.
+func wakeWordFeatures(samples []int16) [][]float64 {
+	var frames [][]float64
+
+	features.New(features.DefaultConfig()).Process(samples, func(f *features.Frame) {
+		frames = append(frames, append([]float64(nil), f.MFCC[1:]...))
+	})
+
+	features.SubtractMean(frames)
+
+	return frames
+}
+
+// trimSilence cuts samples down to the part within 30dB of the
+// loudest frame.
+func trimSilence(samples []int16) []int16 {
+	var (
+		cfg      = features.DefaultConfig()
+		energies []float64
+		loudest  = math.Inf(-1)
+	)
+
+	features.New(cfg).Process(samples, func(f *features.Frame) {
+		energies = append(energies, f.Energy)
+		if f.Energy > loudest {
+			loudest = f.Energy
+		}
+	})
+
+	floor := loudest - math.Log(1000)
+
+	first, last := -1, -1
+
+	for i, e := range energies {
+		if e < floor {
+			continue
+		}
+
+		if first < 0 {
+			first = i
+		}
+
+		last = i
+	}
+
+	if first < 0 {
+		return nil
+	}
+
+	return samples[first*cfg.FrameShift : last*cfg.FrameShift+cfg.FrameLength]
+}
+
+// NewWakeWord makes templates of the recordings, 16kHz mono L16, and
+// sets the threshold from how well they match each other.
+func NewWakeWord(recordings [][]int16) (*WakeWord, error) {
+	if len(recordings) < 2 {
+		return nil, errors.New("need at least two recordings of the wake word")
+	}
+
+	var w WakeWord
+
+	for _, rec := range recordings {
+		t := wakeWordFeatures(trimSilence(rec))
+		if len(t) < minTemplate {
+			return nil, ErrTooShort
+		}
+
+		w.Templates = append(w.Templates, t)
+	}
+
+	for i, a := range w.Templates {
+		nearest := math.Inf(1)
+
+		for j, b := range w.Templates {
+			if i == j {
+				continue
+			}
+
+			nearest = math.Min(nearest, features.DTW(a, b, dtwBand(len(a))))
+		}
+
+		w.Threshold = math.Max(w.Threshold, nearest*thresholdMargin)
+	}
+
+	return &w, nil
+}
+
+func LoadWakeWord(path string) (*WakeWord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var w WakeWord
+
+	err = json.NewDecoder(f).Decode(&w)
+	if err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+func (w *WakeWord) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(w)
+}
+
+func dtwBand(n int) int {
+	return n/4 + 1
+}
+
+// windowScales are the lengths, relative to a template, of the live
+// windows it is compared against, for people saying it faster or
+// slower than when enrolling.
+var windowScales = []float64{0.8, 1, 1.25}
+
+// TemplateSpotter is a KeywordSpotter that compares the last second or
+// so of audio against the enrolled templates of a WakeWord with
+// dynamic time warping. It needs no network and no model.
+type TemplateSpotter struct {
+	Threshold float64
+
+	templates [][][]float64
+	longest   int
+
+	ext     *features.Extractor
+	history [][]float64
+	score   float64
+}
+
+func NewTemplateSpotter(w *WakeWord) *TemplateSpotter {
+	s := &TemplateSpotter{
+		Threshold: w.Threshold,
+		templates: w.Templates,
+		ext:       features.New(features.DefaultConfig()),
+		score:     math.Inf(1),
+	}
+
+	for _, t := range w.Templates {
+		n := int(float64(len(t))*windowScales[len(windowScales)-1]) + 1
+		if n > s.longest {
+			s.longest = n
+		}
+	}
+
+	return s
+}
+
+// Score is the best match of the templates against the audio so far,
+// lower being better.
+func (s *TemplateSpotter) Score() float64 {
+	return s.score
+}
+
+func (s *TemplateSpotter) Spot(frame []int16) bool {
+	s.ext.Process(frame, s.push)
+
+	s.score = math.Inf(1)
+
+	for _, t := range s.templates {
+		for _, scale := range windowScales {
+			n := int(float64(len(t)) * scale)
+			if n > len(s.history) {
+				continue
+			}
+
+			window := normalized(s.history[len(s.history)-n:])
+
+			s.score = math.Min(s.score, features.DTW(t, window, dtwBand(len(t))))
+		}
+	}
+
+	return s.score <= s.Threshold
+}
+
+// push keeps the features of the last frame, reusing the oldest
+// frame's slice once the history is full.
+func (s *TemplateSpotter) push(f *features.Frame) {
+	var v []float64
+
+	if len(s.history) == s.longest {
+		v = s.history[0]
+		copy(s.history, s.history[1:])
+		s.history = s.history[:len(s.history)-1]
+	}
+
+	s.history = append(s.history, append(v[:0], f.MFCC[1:]...))
+}
+
+// normalized returns a copy of window with the mean taken out, so the
+// history is left alone.
+func normalized(window [][]float64) [][]float64 {
+	var (
+		dim  = len(window[0])
+		out  = make([][]float64, len(window))
+		flat = make([]float64, len(window)*dim)
+	)
+
+	for j, f := range window {
+		out[j] = flat[j*dim : (j+1)*dim]
+		copy(out[j], f)
+	}
+
+	features.SubtractMean(out)
+
+	return out
+}
+
+func (s *TemplateSpotter) Reset() {
+	s.history = s.history[:0]
+	s.score = math.Inf(1)
+	s.ext.Reset()
+}
+
+// scoredSpotter notes the score of each detection and the best score
+// seen.
+type scoredSpotter struct {
+	*TemplateSpotter
+	scores []float64
+	best   float64
+}
+
+func (s *scoredSpotter) Spot(frame []int16) bool {
+	hit := s.TemplateSpotter.Spot(frame)
+
+	s.best = math.Min(s.best, s.Score())
+
+	if hit {
+		s.scores = append(s.scores, s.Score())
+	}
+
+	return hit
+}
+
+type EnrollCommand struct {
+	Count int    `long:"count" default:"4" description:"how many times to say the wake word"`
+	Test  string `long:"test" description:"run the enrolled wake word over a WAV file and report detections and scores"`
+
+	InputDevice string `long:"input-device" description:"microphone to use, by index, name or part of a name"`
+}
+
+func (e *EnrollCommand) Execute(args []string) error {
+	if e.Test != "" {
+		return e.test()
+	}
+
+	input, _, err := configuredDevices(e.InputDevice, "")
+	if err != nil {
+		return err
+	}
+
+	mic, err := OpenCapture(input, 0)
+	if err != nil {
+		return err
+	}
+
+	defer mic.Close()
+
+	c := color.New(color.Bold)
+
+	ctx, cancel := interruptible()
+	defer cancel()
+
+	var recordings [][]int16
+
+	for len(recordings) < e.Count {
+		c.Printf("Sag das Weckwort (%d/%d)...\n", len(recordings)+1, e.Count)
+
+		buf, err := ListenIntoBuffer(ctx, ListenOpts{
+			Source:        mic,
+			QuietDuration: 500 * time.Millisecond,
+		})
+		if err != nil {
+			return err
+		}
+
+		samples := make([]int16, buf.Len()/2)
+
+		err = binary.Read(bytes.NewReader(buf.Bytes()), binary.LittleEndian, samples)
+		if err != nil {
+			return err
+		}
+
+		if len(wakeWordFeatures(trimSilence(samples))) < minTemplate {
+			fmt.Println("Das war zu kurz, bitte nochmal.")
+			continue
+		}
+
+		recordings = append(recordings, samples)
+	}
+
+	w, err := NewWakeWord(recordings)
+	if err != nil {
+		return err
+	}
+
+	err = w.Save(WakeWordPath())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("saved %d templates to %s, threshold %.3f\n", len(w.Templates), WakeWordPath(), w.Threshold)
+
+	return nil
+}
+
+func (e *EnrollCommand) test() error {
+	w, err := LoadWakeWord(WakeWordPath())
+	if err != nil {
+		return err
+	}
+
+	s := &scoredSpotter{
+		TemplateSpotter: NewTemplateSpotter(w),
+		best:            math.Inf(1),
+	}
+
+	hits, err := SpotFile(s, e.Test)
+	if err != nil {
+		return err
+	}
+
+	for i, hit := range hits {
+		fmt.Printf("wake word at %s, score %.3f\n", hit, s.scores[i])
+	}
+
+	fmt.Printf("%d detections, best score %.3f, threshold %.3f\n", len(hits), s.best, w.Threshold)
+
+	return nil
+}
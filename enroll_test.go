@@ -0,0 +1,73 @@
+package alexa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/features"
+)
+
+// madeUpWord is a few tones in a row, something like a word, starting
+// at pitch.
+func madeUpWord(pitch float64) []Segment {
+	return []Segment{
+		Tone(pitch, 0.5, 150*time.Millisecond),
+		Tone(pitch*1.5, 0.5, 150*time.Millisecond),
+		Tone(pitch*1.25, 0.5, 200*time.Millisecond),
+	}
+}
+
+func TestTrimSilence(t *testing.T) {
+	var (
+		word    = madeUpWord(500)
+		samples = generate(append(append([]Segment{Silence(time.Second)}, word...), Silence(time.Second))...)
+		trimmed = trimSilence(samples)
+	)
+
+	// Where trimmed starts in samples.
+	start := cap(samples) - cap(trimmed)
+
+	if start < 16000-400 || start > 16000 {
+		t.Errorf("trimmed from %dms, want the word at 1000ms", start/16)
+	}
+
+	if n := len(trimmed); n < 8000 || n > 8000+800 {
+		t.Errorf("trimmed to %dms, want the 500ms word", n/16)
+	}
+}
+
+func TestWakeWordThreshold(t *testing.T) {
+	var (
+		a = generate(madeUpWord(500)...)
+		b = generate(madeUpWord(520)...)
+	)
+
+	w, err := NewWakeWord([][]int16{a, a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a matches the other a perfectly, so b, nearest to a, sets the
+	// threshold.
+	var (
+		fa   = wakeWordFeatures(trimSilence(a))
+		fb   = wakeWordFeatures(trimSilence(b))
+		want = features.DTW(fb, fa, dtwBand(len(fb))) * thresholdMargin
+	)
+
+	if want == 0 || w.Threshold != want {
+		t.Errorf("threshold %g, want %g", w.Threshold, want)
+	}
+
+	_, err = NewWakeWord([][]int16{a})
+	if err == nil {
+		t.Error("enrolled from a single recording")
+	}
+
+	short := generate(Tone(500, 0.5, 100*time.Millisecond))
+
+	_, err = NewWakeWord([][]int16{a, short})
+	if err != ErrTooShort {
+		t.Errorf("got %v for a 100ms recording, want ErrTooShort", err)
+	}
+}
@@ -0,0 +1,108 @@
+package features
+
+import "math"
+
+// Distance is the Euclidean distance between two feature vectors.
+func Distance(a, b []float64) float64 {
+	var sum float64
+
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+
+	return math.Sqrt(sum)
+}
+
+// DTW aligns a with b by dynamic time warping and returns the cost of
+// the best alignment divided by the length of both, so that sequences
+// of different lengths can be compared. The path is kept within band
+// frames of the diagonal; a band of zero leaves it free.
+func DTW(a, b [][]float64, band int) float64 {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return math.Inf(1)
+	}
+
+	if band <= 0 {
+		band = n + m
+	}
+
+	if d := n - m; d > band || -d > band {
+		band = d
+		if band < 0 {
+			band = -band
+		}
+	}
+
+	inf := math.Inf(1)
+
+	prev := make([]float64, m+1)
+	cur := make([]float64, m+1)
+
+	for j := range prev {
+		prev[j] = inf
+	}
+	prev[0] = 0
+
+	for i := 1; i <= n; i++ {
+		for j := range cur {
+			cur[j] = inf
+		}
+
+		// the diagonal, scaled to the shape of the grid
+		centre := i * m / n
+
+		lo, hi := centre-band, centre+band
+		if lo < 1 {
+			lo = 1
+		}
+		if hi > m {
+			hi = m
+		}
+
+		for j := lo; j <= hi; j++ {
+			d := Distance(a[i-1], b[j-1])
+
+			best := prev[j-1] + 2*d
+			if c := prev[j] + d; c < best {
+				best = c
+			}
+			if c := cur[j-1] + d; c < best {
+				best = c
+			}
+
+			cur[j] = best
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[m] / float64(n+m)
+}
+
+// SubtractMean removes the average of each coefficient over frames,
+// which takes out most of the colouring of the microphone and room.
+func SubtractMean(frames [][]float64) {
+	if len(frames) == 0 {
+		return
+	}
+
+	mean := make([]float64, len(frames[0]))
+
+	for _, f := range frames {
+		for i, v := range f {
+			mean[i] += v
+		}
+	}
+
+	for i := range mean {
+		mean[i] /= float64(len(frames))
+	}
+
+	for _, f := range frames {
+		for i := range f {
+			f[i] -= mean[i]
+		}
+	}
+}
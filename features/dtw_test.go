@@ -0,0 +1,66 @@
+package features
+
+import (
+	"math"
+	"testing"
+)
+
+// ramp is n one-coefficient frames going up by one.
+func ramp(n int) [][]float64 {
+	out := make([][]float64, n)
+	for i := range out {
+		out[i] = []float64{float64(i)}
+	}
+
+	return out
+}
+
+// slowed is a with every frame said times times.
+func slowed(a [][]float64, times int) [][]float64 {
+	var out [][]float64
+	for _, f := range a {
+		for i := 0; i < times; i++ {
+			out = append(out, f)
+		}
+	}
+
+	return out
+}
+
+func TestDTWWarps(t *testing.T) {
+	a := ramp(10)
+
+	if d := DTW(a, a, 1); d != 0 {
+		t.Errorf("a sequence is %g from itself", d)
+	}
+
+	// Twice as slow is still a perfect match, even with a band too
+	// narrow for the difference in length.
+	for _, band := range []int{0, 1, 3} {
+		if d := DTW(a, slowed(a, 2), band); d != 0 {
+			t.Errorf("band %d: twice as slow is %g away", band, d)
+		}
+	}
+
+	if d := DTW(ramp(3), ramp(30), 1); math.IsInf(d, 1) {
+		t.Error("lengths further apart than the band don't match at all")
+	}
+
+	if d := DTW(a, nil, 1); !math.IsInf(d, 1) {
+		t.Errorf("nothing is %g away", d)
+	}
+}
+
+func TestDTWScore(t *testing.T) {
+	var (
+		a = ramp(4)
+		b = [][]float64{{0}, {1}, {2}, {5}}
+	)
+
+	// The last frames are 2 apart, and a diagonal step costs twice
+	// that. Going round, by 3 against 2 and then 3 against 5, costs
+	// 1+2 instead, over the 8 frames.
+	if d := DTW(a, b, 0); math.Abs(d-0.375) > 1e-12 {
+		t.Errorf("got %g, want 0.375", d)
+	}
+}
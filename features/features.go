@@ -0,0 +1,335 @@
+// Package features turns audio into the features speech is usually
+// looked at through: pre-emphasised, Hamming windowed frames, their
+// mel filterbank energies, log-mel energies and MFCCs, plus deltas.
+package features
+
+import "math"
+
+type Config struct {
+	SampleRate int
+
+	// FrameLength and FrameShift are in samples.
+	FrameLength int
+	FrameShift  int
+
+	// FFTSize must be a power of two no smaller than FrameLength.
+	FFTSize int
+
+	// PreEmphasis is the coefficient of the first order high pass
+	// applied before framing. Zero turns it off.
+	PreEmphasis float64
+
+	MelBands int
+
+	// LowFreq and HighFreq bound the filterbank, in Hz. A HighFreq of
+	// zero means the Nyquist frequency.
+	LowFreq, HighFreq float64
+
+	// Coefficients is how many MFCCs to keep, including c0.
+	Coefficients int
+}
+
+// DefaultConfig is the usual setup for 16kHz speech: 25ms frames every
+// 10ms, 26 mel bands and 13 coefficients.
+func DefaultConfig() Config {
+	return Config{
+		SampleRate:   16000,
+		FrameLength:  400,
+		FrameShift:   160,
+		FFTSize:      512,
+		PreEmphasis:  0.97,
+		MelBands:     26,
+		LowFreq:      20,
+		Coefficients: 13,
+	}
+}
+
+// Frame is everything computed for one frame of audio. Its slices are
+// reused for the next frame, so copy what needs keeping.
+type Frame struct {
+	// Energy is the log of the windowed frame's energy.
+	Energy float64
+
+	// Power is the power spectrum, FFTSize/2+1 bins.
+	Power []float64
+
+	Mel    []float64
+	LogMel []float64
+	MFCC   []float64
+}
+
+type filter struct {
+	start   int
+	weights []float64
+}
+
+// Extractor computes features for a stream of audio fed to it in
+// chunks of any size.
+type Extractor struct {
+	cfg Config
+
+	window  []float64
+	filters []filter
+	dct     [][]float64
+
+	pending []float64
+	last    float64
+	samples []float64
+	fft     *realFFT
+	frame   Frame
+}
+
+func New(cfg Config) *Extractor {
+	if cfg.HighFreq == 0 {
+		cfg.HighFreq = float64(cfg.SampleRate) / 2
+	}
+
+	e := &Extractor{
+		cfg:     cfg,
+		window:  make([]float64, cfg.FrameLength),
+		samples: make([]float64, cfg.FFTSize),
+		fft:     newRealFFT(cfg.FFTSize),
+		frame: Frame{
+			Power:  make([]float64, cfg.FFTSize/2+1),
+			Mel:    make([]float64, cfg.MelBands),
+			LogMel: make([]float64, cfg.MelBands),
+			MFCC:   make([]float64, cfg.Coefficients),
+		},
+	}
+
+	for i := range e.window {
+		e.window[i] = 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(cfg.FrameLength-1))
+	}
+
+	e.filters = melFilters(cfg)
+	e.dct = dctMatrix(cfg.Coefficients, cfg.MelBands)
+
+	return e
+}
+
+func hzToMel(f float64) float64 {
+	return 2595 * math.Log10(1+f/700)
+}
+
+func melToHz(m float64) float64 {
+	return 700 * (math.Pow(10, m/2595) - 1)
+}
+
+// melFilters builds triangular filters spaced evenly on the mel scale.
+func melFilters(cfg Config) []filter {
+	var (
+		lo      = hzToMel(cfg.LowFreq)
+		hi      = hzToMel(cfg.HighFreq)
+		bins    = cfg.FFTSize/2 + 1
+		binHz   = float64(cfg.SampleRate) / float64(cfg.FFTSize)
+		edges   = make([]float64, cfg.MelBands+2)
+		filters = make([]filter, cfg.MelBands)
+	)
+
+	for i := range edges {
+		edges[i] = melToHz(lo + (hi-lo)*float64(i)/float64(cfg.MelBands+1))
+	}
+
+	for m := range filters {
+		left, centre, right := edges[m], edges[m+1], edges[m+2]
+
+		f := &filters[m]
+		f.start = -1
+
+		for b := 0; b < bins; b++ {
+			hz := float64(b) * binHz
+
+			var w float64
+
+			switch {
+			case hz > left && hz <= centre:
+				w = (hz - left) / (centre - left)
+			case hz > centre && hz < right:
+				w = (right - hz) / (right - centre)
+			}
+
+			if w <= 0 {
+				if f.start >= 0 {
+					break
+				}
+				continue
+			}
+
+			if f.start < 0 {
+				f.start = b
+			}
+
+			f.weights = append(f.weights, w)
+		}
+
+		if f.start < 0 {
+			f.start = 0
+		}
+	}
+
+	return filters
+}
+
+// dctMatrix is an orthonormal DCT-II keeping n of m coefficients.
+func dctMatrix(n, m int) [][]float64 {
+	d := make([][]float64, n)
+
+	for k := range d {
+		d[k] = make([]float64, m)
+
+		scale := math.Sqrt(2 / float64(m))
+		if k == 0 {
+			scale = math.Sqrt(1 / float64(m))
+		}
+
+		for i := range d[k] {
+			d[k][i] = scale * math.Cos(math.Pi*float64(k)*(float64(i)+0.5)/float64(m))
+		}
+	}
+
+	return d
+}
+
+// floor keeps the log of silence finite.
+const floor = 1e-10
+
+// Process feeds in samples and calls fn for every frame they
+// complete.
+func (e *Extractor) Process(samples []int16, fn func(*Frame)) {
+	for _, s := range samples {
+		v := float64(s) / (1 << 15)
+		e.pending = append(e.pending, v-e.cfg.PreEmphasis*e.last)
+		e.last = v
+	}
+
+	for len(e.pending) >= e.cfg.FrameLength {
+		e.compute(e.pending[:e.cfg.FrameLength])
+		fn(&e.frame)
+
+		e.pending = e.pending[:copy(e.pending, e.pending[e.cfg.FrameShift:])]
+	}
+}
+
+// Reset forgets any partial frame, as at the start of a new stream.
+func (e *Extractor) Reset() {
+	e.pending = e.pending[:0]
+	e.last = 0
+}
+
+func (e *Extractor) compute(x []float64) {
+	f := &e.frame
+
+	var energy float64
+
+	for i := range e.samples {
+		var v float64
+		if i < len(x) {
+			v = x[i] * e.window[i]
+			energy += v * v
+		}
+
+		e.samples[i] = v
+	}
+
+	f.Energy = math.Log(math.Max(energy, floor))
+
+	e.fft.power(e.samples, f.Power)
+
+	for i := range f.Power {
+		f.Power[i] /= float64(e.cfg.FFTSize)
+	}
+
+	for m, flt := range e.filters {
+		var sum float64
+
+		for i, w := range flt.weights {
+			sum += w * f.Power[flt.start+i]
+		}
+
+		f.Mel[m] = sum
+		f.LogMel[m] = math.Log(math.Max(sum, floor))
+	}
+
+	for k, row := range e.dct {
+		var sum float64
+
+		for i, w := range row {
+			sum += w * f.LogMel[i]
+		}
+
+		f.MFCC[k] = sum
+	}
+}
+
+// MFCC returns the MFCCs of every frame of samples.
+func MFCC(cfg Config, samples []int16) [][]float64 {
+	var out [][]float64
+
+	New(cfg).Process(samples, func(f *Frame) {
+		out = append(out, append([]float64(nil), f.MFCC...))
+	})
+
+	return out
+}
+
+// Deltas returns the regression over n frames either side of each
+// frame, the usual delta features. The ends are padded by repeating
+// the first and last frame.
+func Deltas(frames [][]float64, n int) [][]float64 {
+	out := make([][]float64, len(frames))
+
+	var norm float64
+	for k := 1; k <= n; k++ {
+		norm += 2 * float64(k*k)
+	}
+
+	at := func(t int) []float64 {
+		if t < 0 {
+			t = 0
+		} else if t >= len(frames) {
+			t = len(frames) - 1
+		}
+
+		return frames[t]
+	}
+
+	for t := range frames {
+		d := make([]float64, len(frames[t]))
+
+		for k := 1; k <= n; k++ {
+			next, prev := at(t+k), at(t-k)
+
+			for i := range d {
+				d[i] += float64(k) * (next[i] - prev[i])
+			}
+		}
+
+		for i := range d {
+			d[i] /= norm
+		}
+
+		out[t] = d
+	}
+
+	return out
+}
+
+// WithDeltas returns each frame followed by its deltas and its delta
+// deltas.
+func WithDeltas(frames [][]float64, n int) [][]float64 {
+	d := Deltas(frames, n)
+	dd := Deltas(d, n)
+
+	out := make([][]float64, len(frames))
+
+	for t := range frames {
+		v := make([]float64, 0, 3*len(frames[t]))
+		v = append(v, frames[t]...)
+		v = append(v, d[t]...)
+		v = append(v, dd[t]...)
+
+		out[t] = v
+	}
+
+	return out
+}
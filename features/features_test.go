@@ -0,0 +1,118 @@
+package features
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// dft is the power in bin k of x, worked out the long way.
+func dft(x []float64, k int) float64 {
+	var re, im float64
+
+	for i, v := range x {
+		a := -2 * math.Pi * float64(k) * float64(i) / float64(len(x))
+		re += v * math.Cos(a)
+		im += v * math.Sin(a)
+	}
+
+	return re*re + im*im
+}
+
+func TestRealFFT(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for _, n := range []int{2, 4, 64, 512} {
+		var (
+			x     = make([]float64, n)
+			power = make([]float64, n/2+1)
+		)
+
+		for i := range x {
+			x[i] = r.Float64()*2 - 1
+		}
+
+		newRealFFT(n).power(x, power)
+
+		got := fft.FFTReal(x)
+
+		for k := range power {
+			want := dft(x, k)
+
+			if math.Abs(power[k]-want) > 1e-9*math.Max(1, want) {
+				t.Fatalf("n=%d: bin %d has power %g, want %g", n, k, power[k], want)
+			}
+
+			// And it agrees with go-dsp, which it stands in for.
+			c := got[k]
+			if p := real(c)*real(c) + imag(c)*imag(c); math.Abs(power[k]-p) > 1e-9*math.Max(1, p) {
+				t.Fatalf("n=%d: bin %d has power %g, go-dsp says %g", n, k, power[k], p)
+			}
+		}
+	}
+}
+
+func tone(f float64, n int) []int16 {
+	s := make([]int16, n)
+	for i := range s {
+		s[i] = int16(8000 * math.Sin(2*math.Pi*f*float64(i)/16000))
+	}
+
+	return s
+}
+
+func TestToneFrames(t *testing.T) {
+	var (
+		cfg    = DefaultConfig()
+		frames int
+	)
+
+	New(cfg).Process(tone(1000, 16000), func(f *Frame) {
+		frames++
+
+		peak := 0
+		for i := range f.Power {
+			if f.Power[i] > f.Power[peak] {
+				peak = i
+			}
+		}
+
+		if hz := float64(peak) * 16000 / float64(cfg.FFTSize); math.Abs(hz-1000) > 16000/float64(cfg.FFTSize) {
+			t.Fatalf("a 1kHz tone peaks at %gHz", hz)
+		}
+	})
+
+	// 25ms frames every 10ms over a second.
+	if frames != 98 {
+		t.Errorf("got %d frames, want 98", frames)
+	}
+
+	mfcc := MFCC(cfg, tone(1000, 16000))
+	all := WithDeltas(mfcc, 2)
+
+	if len(all[0]) != 3*cfg.Coefficients {
+		t.Errorf("got %d features with deltas, want %d", len(all[0]), 3*cfg.Coefficients)
+	}
+
+	// A steady tone doesn't change.
+	if d := all[50][cfg.Coefficients]; math.Abs(d) > 1e-6 {
+		t.Errorf("delta of a steady tone is %g", d)
+	}
+}
+
+func TestProcessDoesNotAllocate(t *testing.T) {
+	var (
+		e       = New(DefaultConfig())
+		samples = tone(440, 160)
+		fn      = func(*Frame) {}
+	)
+
+	// Fill the first frame, so that every run after completes one.
+	e.Process(tone(440, 400), fn)
+
+	if n := testing.AllocsPerRun(100, func() { e.Process(samples, fn) }); n != 0 {
+		t.Errorf("Process allocates %g times a frame, want none", n)
+	}
+}
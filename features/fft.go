@@ -0,0 +1,95 @@
+package features
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// realFFT takes the power spectrum of real frames of one power of two
+// size without allocating. The frame is packed into half as many
+// complex numbers, even samples as the real part and odd ones as the
+// imaginary, transformed in place and then split back into the
+// spectrum of the real frame. go-dsp's fft.FFTReal, which vad.go
+// uses, allocates its result on every call, too much for every frame
+// of Process.
+type realFFT struct {
+	n   int
+	buf []complex128
+	rev []int
+
+	// twiddle is e^(-2πik/(n/2)) for the half size transform, split
+	// e^(-2πik/n) for putting the halves back together.
+	twiddle []complex128
+	split   []complex128
+}
+
+func newRealFFT(n int) *realFFT {
+	m := n / 2
+
+	f := &realFFT{
+		n:       n,
+		buf:     make([]complex128, m),
+		rev:     make([]int, m),
+		twiddle: make([]complex128, m/2),
+		split:   make([]complex128, m+1),
+	}
+
+	bits := 0
+	for 1<<uint(bits) < m {
+		bits++
+	}
+
+	for i := range f.rev {
+		r := 0
+		for b := 0; b < bits; b++ {
+			if i&(1<<uint(b)) != 0 {
+				r |= 1 << uint(bits-1-b)
+			}
+		}
+
+		f.rev[i] = r
+	}
+
+	for k := range f.twiddle {
+		f.twiddle[k] = cmplx.Exp(complex(0, -2*math.Pi*float64(k)/float64(m)))
+	}
+
+	for k := range f.split {
+		f.split[k] = cmplx.Exp(complex(0, -2*math.Pi*float64(k)/float64(n)))
+	}
+
+	return f
+}
+
+// power writes |X[k]|² of the n samples of x to the n/2+1 bins of dst.
+func (f *realFFT) power(x, dst []float64) {
+	m := len(f.buf)
+
+	for i := range f.buf {
+		f.buf[f.rev[i]] = complex(x[2*i], x[2*i+1])
+	}
+
+	for size := 2; size <= m; size <<= 1 {
+		half, step := size/2, m/size
+
+		for start := 0; start < m; start += size {
+			for j := 0; j < half; j++ {
+				a, b := start+j, start+j+half
+
+				t := f.twiddle[j*step] * f.buf[b]
+				f.buf[b] = f.buf[a] - t
+				f.buf[a] += t
+			}
+		}
+	}
+
+	for k := 0; k <= m; k++ {
+		z, zc := f.buf[k%m], cmplx.Conj(f.buf[(m-k)%m])
+
+		even := (z + zc) / 2
+		odd := (z - zc) / complex(0, 2)
+
+		c := even + f.split[k]*odd
+		dst[k] = real(c)*real(c) + imag(c)*imag(c)
+	}
+}
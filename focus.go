@@ -0,0 +1,230 @@
+package alexa
+
+import (
+	"sync"
+)
+
+// The channels a FocusManager hands out, from the most important
+// down.
+const (
+	DialogChannel  = "Dialog"
+	AlertsChannel  = "Alerts"
+	ContentChannel = "Content"
+)
+
+var channelOrder = []string{DialogChannel, AlertsChannel, ContentChannel}
+
+// Focus is how much of the output an activity gets.
+type Focus int
+
+const (
+	// FocusNone is for an activity that has lost its channel to
+	// another.
+	FocusNone Focus = iota
+
+	// FocusPaused means something more important is going on; the
+	// activity should hold until it's back in the foreground.
+	FocusPaused
+
+	// FocusDucked means something more important is going on, but the
+	// activity can carry on quietly underneath.
+	FocusDucked
+
+	FocusForeground
+)
+
+// DefaultDuckVolume is how loud a ducked activity is played.
+const DefaultDuckVolume = 0.2
+
+// background is what each channel does while a more important one is
+// in use: music carries on quietly under alexa, an alarm waits for her
+// to finish.
+var background = map[string]Focus{
+	AlertsChannel:  FocusPaused,
+	ContentChannel: FocusDucked,
+}
+
+// Activity is something that wants to be heard on a channel.
+type Activity interface {
+	// FocusChanged is told the activity's focus whenever it changes. It
+	// may call back into the FocusManager.
+	FocusChanged(Focus)
+}
+
+// FocusFunc turns a plain function into an Activity.
+type FocusFunc func(Focus)
+
+func (f FocusFunc) FocusChanged(focus Focus) {
+	f(focus)
+}
+
+// FocusManager decides who gets heard between alexa talking, alerts
+// and music: the most important channel in use is in the foreground,
+// and the rest duck or pause under it.
+type FocusManager struct {
+	lock   sync.Mutex
+	active map[string]*focusEntry
+}
+
+type focusEntry struct {
+	activity Activity
+	focus    Focus
+}
+
+type focusChange struct {
+	activity Activity
+	focus    Focus
+}
+
+// Acquire puts a on channel, replacing whatever was there, and returns
+// the function that takes it off again.
+func (f *FocusManager) Acquire(channel string, a Activity) (release func()) {
+	e := &focusEntry{activity: a, focus: FocusNone}
+
+	f.lock.Lock()
+
+	if f.active == nil {
+		f.active = make(map[string]*focusEntry)
+	}
+
+	var changes []focusChange
+
+	if old := f.active[channel]; old != nil {
+		changes = append(changes, focusChange{old.activity, FocusNone})
+	}
+
+	f.active[channel] = e
+	changes = append(changes, f.update()...)
+
+	f.lock.Unlock()
+
+	notify(changes)
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			f.release(channel, e)
+		})
+	}
+}
+
+func (f *FocusManager) release(channel string, e *focusEntry) {
+	f.lock.Lock()
+
+	if f.active[channel] != e {
+		f.lock.Unlock()
+		return
+	}
+
+	delete(f.active, channel)
+	changes := f.update()
+
+	f.lock.Unlock()
+
+	notify(changes)
+}
+
+// Focus is the focus of whatever is on channel, FocusNone if nothing
+// is.
+func (f *FocusManager) Focus(channel string) Focus {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if e := f.active[channel]; e != nil {
+		return e.focus
+	}
+
+	return FocusNone
+}
+
+// update works out everyone's focus afresh, returning the changes.
+// It's called with the lock held.
+func (f *FocusManager) update() []focusChange {
+	var (
+		changes []focusChange
+		top     = true
+	)
+
+	for _, channel := range channelOrder {
+		e := f.active[channel]
+		if e == nil {
+			continue
+		}
+
+		focus := FocusForeground
+		if !top {
+			focus = background[channel]
+		}
+
+		top = false
+
+		if e.focus != focus {
+			e.focus = focus
+			changes = append(changes, focusChange{e.activity, focus})
+		}
+	}
+
+	return changes
+}
+
+func notify(changes []focusChange) {
+	for _, c := range changes {
+		c.activity.FocusChanged(c.focus)
+	}
+}
+
+// volumeSetter is a Player that can be turned down.
+type volumeSetter interface {
+	SetVolume(float64)
+}
+
+// PlayerFocus has a Player follow its focus: ducked by turning it
+// down, if it can be, and otherwise paused, and stopped once it has
+// lost its channel.
+func PlayerFocus(p Player) Activity {
+	var f focusFollower
+
+	return FocusFunc(func(focus Focus) {
+		f.follow(focus, p, func() bool { p.Pause(); return true }, func() { p.Resume() }, func() { p.Stop() })
+	})
+}
+
+// focusFollower ducks, pauses, resumes or stops a player, whichever
+// its focus calls for. It only resumes what it paused itself, so that
+// what the user paused stays paused.
+type focusFollower struct {
+	lock   sync.Mutex
+	paused bool
+}
+
+// follow has player follow focus. pause reports whether it paused
+// anything; it didn't if the player was paused already.
+func (f *focusFollower) follow(focus Focus, player Player, pause func() bool, resume, stop func()) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	v, ducks := player.(volumeSetter)
+
+	switch {
+	case focus == FocusNone:
+		f.paused = false
+		stop()
+	case focus == FocusForeground, focus == FocusDucked && ducks:
+		volume := 1.0
+		if focus == FocusDucked {
+			volume = DefaultDuckVolume
+		}
+
+		if ducks {
+			v.SetVolume(volume)
+		}
+
+		if f.paused {
+			f.paused = false
+			resume()
+		}
+	case !f.paused:
+		f.paused = pause()
+	}
+}
@@ -0,0 +1,77 @@
+package alexa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/directives"
+)
+
+// playingWithFocus starts a long stream on an AudioPlayer that follows
+// focus.
+func playingWithFocus(t *testing.T) (*AudioPlayer, *FocusManager) {
+	var (
+		s     = newStreamServer(t)
+		focus = &FocusManager{}
+		a     = NewAudioPlayer(&streamPlayer{}, nil)
+	)
+
+	a.Focus = focus
+	a.Play(playDirective(directives.ReplaceAll, "long", s.URL+"/a/5000", ""))
+	t.Cleanup(func() { a.Close() })
+
+	for deadline := time.Now().Add(5 * time.Second); focus.Focus(ContentChannel) != FocusForeground; {
+		if time.Now().After(deadline) {
+			t.Fatal("playback never started")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	return a, focus
+}
+
+func activity(a *AudioPlayer) string {
+	return a.playbackState().PlayerActivity
+}
+
+func TestFocusPausesAndResumes(t *testing.T) {
+	a, focus := playingWithFocus(t)
+
+	release := focus.Acquire(DialogChannel, FocusFunc(func(Focus) {}))
+
+	if got := activity(a); got != ActivityPaused {
+		t.Errorf("%s while alexa talks, want PAUSED", got)
+	}
+
+	release()
+
+	if got := activity(a); got != ActivityPlaying {
+		t.Errorf("%s after alexa is done, want PLAYING", got)
+	}
+}
+
+func TestFocusKeepsUserPause(t *testing.T) {
+	a, focus := playingWithFocus(t)
+
+	a.Pause()
+
+	release := focus.Acquire(DialogChannel, FocusFunc(func(Focus) {}))
+	release()
+
+	if got := activity(a); got != ActivityPaused {
+		t.Errorf("%s after alexa is done, want still PAUSED as the user left it", got)
+	}
+}
+
+func TestFocusNoneStops(t *testing.T) {
+	a, focus := playingWithFocus(t)
+
+	focus.Acquire(ContentChannel, FocusFunc(func(Focus) {}))
+
+	if got := activity(a); got != ActivityStopped {
+		t.Errorf("%s after losing the channel, want STOPPED", got)
+	}
+
+	waitIdle(t, a)
+}
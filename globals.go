@@ -1,6 +1,58 @@
 package alexa
 
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/Fruchtgummi/alexa/avs"
+)
+
 type GlobalOptions struct {
+	Endpoint string `long:"endpoint" description:"AVS endpoint to talk to" default:"https://avs-alexa-na.amazon.com"`
+	Locale   string `long:"locale" description:"Locale to talk to alexa in" default:"en-US"`
 }
 
 var Globals GlobalOptions
+
+func (g *GlobalOptions) endpoint() string {
+	if g.Endpoint == "" {
+		return avs.DefaultEndpoint
+	}
+
+	return g.Endpoint
+}
+
+// Client returns a Client set up from the global options. It talks
+// HTTP/2, so it can share a connection with a downchannel.
+func (g *GlobalOptions) Client() *Client {
+	c := NewClient(ConfigTokens)
+	c.HTTPClient = avs.NewClient(g.endpoint())
+	c.Endpoint = g.endpoint()
+
+	if g.Locale != "" {
+		c.Locale = g.Locale
+	}
+
+	return c
+}
+
+// interruptible returns a context that is cancelled by ^C.
+func interruptible() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+
+		signal.Stop(sig)
+	}()
+
+	return ctx, cancel
+}
@@ -0,0 +1,247 @@
+package alexa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+type ListenCommand struct {
+	WakeCommand string        `long:"wake-command" description:"keyword spotter to run instead of the enrolled wake word; it gets 16kHz mono L16 on stdin and prints a line for every wake word"`
+	PreRoll     time.Duration `long:"pre-roll" default:"500ms" description:"how much audio from before the wake word is sent along"`
+	Test        string        `long:"test" description:"run the spotter over a WAV file and report where it fires"`
+
+	InputDevice  string `long:"input-device" description:"microphone to use, by index, name or part of a name"`
+	OutputDevice string `long:"output-device" description:"speaker to use, by index, name or part of a name"`
+	Player       string `long:"player" description:"how to play alexa's answers" choice:"portaudio" choice:"mpg123" default:"portaudio"`
+	VAD          string `long:"vad" description:"how to tell when you're talking" choice:"flux" choice:"energy" choice:"band" default:"flux"`
+
+	MaxWait   time.Duration `long:"max-wait" default:"5s" description:"how long to wait for the question after the wake word"`
+	MaxLength time.Duration `long:"max-length" default:"30s" description:"longest question to listen to"`
+	BargeIn   bool          `long:"barge-in" description:"let you interrupt an answer with the wake word or by talking over it"`
+}
+
+func (l *ListenCommand) Execute(args []string) error {
+	spotter, err := l.spotter()
+	if err != nil {
+		return err
+	}
+
+	if c, ok := spotter.(*CommandSpotter); ok {
+		defer c.Close()
+	}
+
+	if l.Test != "" {
+		hits, err := SpotFile(spotter, l.Test)
+		if err != nil {
+			return err
+		}
+
+		for _, hit := range hits {
+			fmt.Printf("wake word at %s\n", hit)
+		}
+
+		return nil
+	}
+
+	var opts ListenOpts
+
+	opts.Detector, err = NewVoiceDetector(l.VAD)
+	if err != nil {
+		return err
+	}
+
+	opts.MaxInitialSilence = l.MaxWait
+	opts.MaxUtterance = l.MaxLength
+
+	if l.BargeIn {
+		opts.BargeIn = &BargeIn{Spotter: spotter}
+	}
+
+	opts.InputDevice, opts.OutputDevice, err = configuredDevices(l.InputDevice, l.OutputDevice)
+	if err != nil {
+		return err
+	}
+
+	output, err := OpenOutput(l.Player, opts.OutputDevice)
+	if err != nil {
+		return err
+	}
+
+	opts.Player = output()
+
+	mic, err := OpenCapture(opts.InputDevice, 0)
+	if err != nil {
+		return err
+	}
+
+	defer mic.Close()
+
+	c := color.New(color.Bold)
+
+	opts.State = func(s State) {
+		switch s {
+		case Listening:
+			c.Println("Höre...")
+		case Asking:
+			c.Println("Frage...")
+		case Interrupted:
+			c.Println("Ja?")
+		}
+	}
+
+	client := Globals.Client()
+
+	err = setUpDevice(client, output, &opts)
+	if err != nil {
+		return err
+	}
+
+	defer opts.AudioPlayer.Close()
+
+	// Alerts set from the app, and AVS stopping the music, come down
+	// the downchannel.
+	dc := client.Downchannel(opts.Directives)
+	dc.Start()
+
+	defer dc.Close()
+
+	w := &WakeListener{
+		Source:  mic,
+		Spotter: spotter,
+		PreRoll: l.PreRoll,
+		Opts:    opts,
+		Client:  client,
+		Woke: func() {
+			c.Println("Ja?")
+		},
+	}
+
+	ctx, cancel := interruptible()
+	defer cancel()
+
+	c.Println("Warte auf das Weckwort...")
+
+	go opts.Alerts.Run(ctx)
+	go Controls(ctx, client, os.Stdin, opts.Directives, opts.Alerts)
+
+	return w.Run(ctx)
+}
+
+// spotter is the --wake-command if there is one, and otherwise the
+// wake word enrolled with alexa enroll.
+func (l *ListenCommand) spotter() (KeywordSpotter, error) {
+	if l.WakeCommand != "" {
+		return StartCommandSpotter(l.WakeCommand)
+	}
+
+	w, err := LoadWakeWord(WakeWordPath())
+	if os.IsNotExist(err) {
+		return nil, errors.New("no wake word enrolled; run alexa enroll or pass --wake-command")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTemplateSpotter(w), nil
+}
+
+// WakeListener listens for the wake word and asks alexa whatever is
+// said after it, over and over.
+type WakeListener struct {
+	Source  AudioSource
+	Spotter KeywordSpotter
+	Client  *Client
+
+	// PreRoll is how much audio from before the wake word fired is
+	// sent with the question, so the start isn't lost.
+	PreRoll time.Duration
+
+	// Opts is used for every question. Its Source is replaced.
+	Opts ListenOpts
+
+	// Woke is called when the wake word is heard.
+	Woke func()
+}
+
+// flusher is a source that can drop the audio it has queued up.
+type flusher interface {
+	Flush()
+}
+
+// Run listens until ctx is done or the source runs out.
+func (w *WakeListener) Run(ctx context.Context) error {
+	var (
+		src    = NewL16Source(w.Source)
+		frame  = make([]int16, SpotterFrame)
+		recent = NewRing(int(w.PreRoll * 16000 / time.Second))
+		ep     = w.Opts.Endpointer
+	)
+
+	// The noise floor is learnt once for all the questions.
+	if ep == nil {
+		ep = &Endpointer{}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		err := readFull(src, frame)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		recent.Write(frame)
+
+		if !w.Spotter.Spot(frame) {
+			continue
+		}
+
+		if w.Woke != nil {
+			w.Woke()
+		}
+
+		pre := make([]int16, recent.Len())
+
+		opts := w.Opts
+		opts.Endpointer = ep
+		opts.Source = &prerolledSource{
+			AudioSource: src,
+			pre:         pre[:recent.Read(pre)],
+		}
+
+		err = Listen(ctx, w.Client, opts)
+		if err == ErrNoSpeech {
+			err = nil
+		}
+
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		}
+
+		// What queued up while alexa was answering is stale, and
+		// likely her saying the wake word; spotting starts again from
+		// now.
+		if f, ok := w.Source.(flusher); ok {
+			f.Flush()
+			src = NewL16Source(w.Source)
+		}
+
+		recent.Discard()
+		w.Spotter.Reset()
+	}
+}
@@ -0,0 +1,537 @@
+package alexa
+
+import (
+	"io"
+	"io/ioutil"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/audio/wav"
+	"github.com/Fruchtgummi/alexa/portaudio"
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// mixBlock is how many frames the Mixer mixes and writes at a time.
+const mixBlock = 1024
+
+// trackBuffer is how many blocks of decoded audio a Track keeps ahead
+// of the mixer.
+const trackBuffer = 4
+
+// volumeRamp is how long a Track takes to get to a new volume, so that
+// ducking doesn't click.
+const volumeRamp = 50 * time.Millisecond
+
+// Sink is where a Mixer's output goes.
+type Sink interface {
+	SampleRate() float64
+	Channels() int
+
+	// Write plays a block of interleaved samples, blocking while the
+	// output is busy.
+	Write(samples []int16) error
+
+	// Drain is called once there's nothing left to play. The sink can
+	// let go of the device until the next Write.
+	Drain() error
+}
+
+// Mixer plays any number of Tracks at once on a single Sink, each at
+// its own volume.
+type Mixer struct {
+	sink     Sink
+	rate     float64
+	channels int
+
+	lock    sync.Mutex
+	cond    *sync.Cond
+	tracks  []*Track
+	running bool
+	err     error
+	levels  []float64
+}
+
+func NewMixer(sink Sink) *Mixer {
+	m := &Mixer{
+		sink:     sink,
+		rate:     sink.SampleRate(),
+		channels: sink.Channels(),
+	}
+
+	m.cond = sync.NewCond(&m.lock)
+
+	return m
+}
+
+// Track returns a new input to the mixer, at full volume.
+func (m *Mixer) Track() *Track {
+	return &Track{mixer: m, volume: 1}
+}
+
+// add starts mixing t in, starting the mixer if it isn't running.
+func (m *Mixer) add(t *Track) {
+	m.tracks = append(m.tracks, t)
+
+	if !m.running {
+		m.running = true
+		m.err = nil
+		m.levels = m.levels[:0]
+
+		go m.run()
+	}
+}
+
+func (m *Mixer) remove(t *Track) {
+	for i, o := range m.tracks {
+		if o == t {
+			m.tracks = append(m.tracks[:i], m.tracks[i+1:]...)
+			break
+		}
+	}
+}
+
+// run mixes and writes blocks until there are no tracks left.
+func (m *Mixer) run() {
+	var (
+		mix = make([]float64, mixBlock*m.channels)
+		out = make([]int16, len(mix))
+	)
+
+	m.lock.Lock()
+
+	for {
+		m.mixAll(mix, out)
+
+		if !m.running {
+			m.lock.Unlock()
+			return
+		}
+
+		// Still running while draining, so that a track added
+		// meanwhile is played by this run, rather than a new one
+		// writing to the sink as it's drained.
+		m.lock.Unlock()
+		m.sink.Drain()
+		m.lock.Lock()
+
+		if len(m.tracks) == 0 {
+			m.running = false
+			m.lock.Unlock()
+			return
+		}
+	}
+}
+
+// mixAll mixes and writes blocks until there are no tracks left, or
+// the sink fails, which stops the mixer. It's called with the lock
+// held.
+func (m *Mixer) mixAll(mix []float64, out []int16) {
+	for len(m.tracks) > 0 {
+		for i := range mix {
+			mix[i] = 0
+		}
+
+		for _, t := range m.tracks {
+			t.mix(mix)
+		}
+
+		m.cond.Broadcast()
+		m.lock.Unlock()
+
+		for i, s := range mix {
+			out[i] = wav.ToInt16(s)
+		}
+
+		err := m.sink.Write(out)
+
+		m.lock.Lock()
+
+		if err != nil {
+			m.err = err
+			m.running = false
+			m.cond.Broadcast()
+			return
+		}
+
+		m.levels = append(m.levels, decibels(out))
+		if len(m.levels) > levelHistory {
+			m.levels = m.levels[:copy(m.levels, m.levels[1:])]
+		}
+	}
+}
+
+// Track is one input of a Mixer. It's a Player, so it plays mp3s.
+type Track struct {
+	mixer *Mixer
+
+	// All guarded by the mixer's lock.
+	pending []float64
+	gain    float64
+	volume  float64
+	frames  int64
+	playing bool
+	paused  bool
+	stopped bool
+	cued    bool
+}
+
+// SetVolume sets how loud the track is mixed in, 0 being silent and 1
+// as loud as the audio itself. The track gets there over a moment.
+func (t *Track) SetVolume(v float64) {
+	t.mixer.lock.Lock()
+	defer t.mixer.lock.Unlock()
+
+	t.volume = v
+}
+
+// Volume is where the track's volume is headed.
+func (t *Track) Volume() float64 {
+	t.mixer.lock.Lock()
+	defer t.mixer.lock.Unlock()
+
+	return t.volume
+}
+
+func (t *Track) Play(r io.Reader) error {
+	return t.PlayFrom(r, 0)
+}
+
+// PlayFrom plays r starting offset into it. Position counts from
+// there.
+func (t *Track) PlayFrom(r io.Reader, offset time.Duration) error {
+	m := t.mixer
+
+	m.lock.Lock()
+	t.frames = 0
+	m.lock.Unlock()
+
+	dec, err := mp3.NewDecoder(r)
+	if err != nil {
+		return err
+	}
+
+	err = skipMP3(dec, offset)
+	if err != nil {
+		return err
+	}
+
+	var (
+		conv = newPCMConverter(float64(dec.SampleRate()), m.rate, m.channels)
+		raw  = make([]byte, 4096)
+	)
+
+	return t.play(func(dst []float64) ([]float64, error) {
+		n, err := dec.Read(raw)
+		if err != nil && err != io.EOF {
+			return dst, err
+		}
+
+		return conv.convert(dst, raw[:n-n%4], err == io.EOF), err
+	})
+}
+
+// PlaySource plays src, for sounds made up on the spot rather than
+// decoded.
+func (t *Track) PlaySource(src AudioSource) error {
+	m := t.mixer
+
+	m.lock.Lock()
+	t.frames = 0
+	m.lock.Unlock()
+
+	var (
+		conv = newPCMConverter(float64(src.SampleRate()), m.rate, m.channels)
+		in   = make([]int16, mixBlock*src.Channels())
+	)
+
+	return t.play(func(dst []float64) ([]float64, error) {
+		n, err := src.Read(in)
+		if err != nil && err != io.EOF {
+			return dst, err
+		}
+
+		return conv.convertSamples(dst, in[:n], src.Channels(), err == io.EOF), err
+	})
+}
+
+// play feeds the mixer from read until it returns io.EOF and all of it
+// has been played, or the track is stopped.
+func (t *Track) play(read func([]float64) ([]float64, error)) error {
+	m := t.mixer
+
+	// A paused track stays paused; only Resume, or its focus, can
+	// bring it back. A Stop since Cue stops this.
+	m.lock.Lock()
+	if !t.cued {
+		t.stopped = false
+	}
+
+	t.cued = false
+	t.pending = t.pending[:0]
+	t.gain = t.volume
+	t.playing = true
+	m.add(t)
+	m.lock.Unlock()
+
+	defer func() {
+		m.lock.Lock()
+		t.playing = false
+		m.remove(t)
+		m.lock.Unlock()
+	}()
+
+	var buf []float64
+
+	for {
+		var err error
+
+		buf, err = read(buf[:0])
+
+		done := err == io.EOF
+		if err != nil && !done {
+			return err
+		}
+
+		m.lock.Lock()
+
+		for len(t.pending) >= trackBuffer*mixBlock*m.channels && !t.stopped && m.err == nil {
+			m.cond.Wait()
+		}
+
+		if t.stopped || m.err != nil {
+			err = m.err
+			m.lock.Unlock()
+			return err
+		}
+
+		t.pending = append(t.pending, buf...)
+		m.lock.Unlock()
+
+		if done {
+			break
+		}
+	}
+
+	// Wait for the mixer to have played the end of it.
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for len(t.pending) > 0 && !t.stopped && m.err == nil {
+		m.cond.Wait()
+	}
+
+	return m.err
+}
+
+// mix adds a block of the track to dst. It's called with the mixer's
+// lock held.
+func (t *Track) mix(dst []float64) {
+	if t.paused {
+		return
+	}
+
+	var (
+		ch   = t.mixer.channels
+		step = 1 / (t.mixer.rate * volumeRamp.Seconds())
+		n    = len(dst)
+	)
+
+	if len(t.pending) < n {
+		n = len(t.pending)
+	}
+
+	for i := 0; i+ch <= n; i += ch {
+		switch {
+		case t.gain < t.volume:
+			t.gain = math.Min(t.gain+step, t.volume)
+		case t.gain > t.volume:
+			t.gain = math.Max(t.gain-step, t.volume)
+		}
+
+		for c := 0; c < ch; c++ {
+			dst[i+c] += t.pending[i+c] * t.gain
+		}
+	}
+
+	t.pending = t.pending[:copy(t.pending, t.pending[n:])]
+	t.frames += int64(n / ch)
+}
+
+func (t *Track) Stop() error {
+	t.mixer.lock.Lock()
+	defer t.mixer.lock.Unlock()
+
+	t.stopped = true
+	t.mixer.cond.Broadcast()
+
+	return nil
+}
+
+// Cue readies t for the next Play: a Stop from now on stops it, even if
+// it comes first.
+func (t *Track) Cue() {
+	t.mixer.lock.Lock()
+	defer t.mixer.lock.Unlock()
+
+	t.stopped = false
+	t.cued = true
+}
+
+func (t *Track) Pause() error {
+	t.mixer.lock.Lock()
+	defer t.mixer.lock.Unlock()
+
+	t.paused = true
+
+	return nil
+}
+
+func (t *Track) Resume() error {
+	t.mixer.lock.Lock()
+	defer t.mixer.lock.Unlock()
+
+	t.paused = false
+
+	return nil
+}
+
+func (t *Track) Position() time.Duration {
+	t.mixer.lock.Lock()
+	defer t.mixer.lock.Unlock()
+
+	return time.Duration(float64(t.frames) / t.mixer.rate * float64(time.Second))
+}
+
+// Level is how loud the mixer's output has been lately, in dB, all
+// tracks together since that's what the microphone hears.
+func (t *Track) Level() float64 {
+	m := t.mixer
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	level := float64(silenceLevel)
+
+	if !t.playing || t.paused {
+		return level
+	}
+
+	for _, l := range m.levels {
+		level = math.Max(level, l)
+	}
+
+	return level
+}
+
+// skipMP3 decodes and drops the first offset of dec.
+func skipMP3(dec *mp3.Decoder, offset time.Duration) error {
+	if offset <= 0 {
+		return nil
+	}
+
+	skip := int64(offset.Seconds()*float64(dec.SampleRate())) * 4
+
+	_, err := io.CopyN(ioutil.Discard, dec, skip)
+	if err == io.EOF {
+		return nil
+	}
+
+	return err
+}
+
+// PortAudioSink is a Sink on a PortAudio output device. The device is
+// only held while there's something to play.
+type PortAudioSink struct {
+	lock   sync.Mutex
+	params portaudio.StreamParameters
+	out    []int16
+	stream *portaudio.Stream
+}
+
+// NewPortAudioSink finds the output device, see FindDevice, and how it
+// wants its audio.
+func NewPortAudioSink(device string) (*PortAudioSink, error) {
+	err := portaudio.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	defer portaudio.Terminate()
+
+	dev, err := FindDevice(device, false)
+	if err != nil {
+		return nil, err
+	}
+
+	params := OutputParameters(dev)
+	params.FramesPerBuffer = mixBlock
+
+	return &PortAudioSink{params: params}, nil
+}
+
+func (s *PortAudioSink) SampleRate() float64 { return s.params.SampleRate }
+func (s *PortAudioSink) Channels() int       { return s.params.Output.Channels }
+
+func (s *PortAudioSink) Write(samples []int16) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.stream == nil {
+		err := s.open()
+		if err != nil {
+			return err
+		}
+	}
+
+	copy(s.out, samples)
+
+	// An underflow is a glitch that's already been heard.
+	err := s.stream.Write()
+	if err != nil && err != portaudio.ErrOutputUnderflowed {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PortAudioSink) open() error {
+	err := portaudio.Initialize()
+	if err != nil {
+		return err
+	}
+
+	s.out = make([]int16, s.params.FramesPerBuffer*s.params.Output.Channels)
+
+	stream, err := portaudio.OpenStream(s.params, s.out)
+	if err != nil {
+		portaudio.Terminate()
+		return err
+	}
+
+	err = stream.Start()
+	if err != nil {
+		stream.Close()
+		portaudio.Terminate()
+		return err
+	}
+
+	s.stream = stream
+	return nil
+}
+
+func (s *PortAudioSink) Drain() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.stream == nil {
+		return nil
+	}
+
+	err := s.stream.Stop()
+	s.stream.Close()
+	s.stream = nil
+	portaudio.Terminate()
+
+	return err
+}
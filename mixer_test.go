@@ -0,0 +1,299 @@
+package alexa
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSink keeps what the mixer writes to it, at 16kHz mono.
+type fakeSink struct {
+	lock     sync.Mutex
+	written  []int16
+	writes   int
+	drains   int
+	draining bool
+	overlaps int
+
+	// onWrite, if set, is called with the number of each write.
+	onWrite func(int)
+
+	// drain, if set, holds up Drain until it's closed; drainStarted is
+	// closed once the first Drain is under way.
+	drain        chan struct{}
+	drainStarted chan struct{}
+}
+
+func (s *fakeSink) SampleRate() float64 { return 16000 }
+func (s *fakeSink) Channels() int       { return 1 }
+
+func (s *fakeSink) Write(samples []int16) error {
+	s.lock.Lock()
+	if s.draining {
+		s.overlaps++
+	}
+
+	s.written = append(s.written, samples...)
+	s.writes++
+	n, onWrite := s.writes, s.onWrite
+	s.lock.Unlock()
+
+	if onWrite != nil {
+		onWrite(n)
+	}
+
+	return nil
+}
+
+func (s *fakeSink) Drain() error {
+	s.lock.Lock()
+	s.draining = true
+	s.drains++
+	first := s.drains == 1
+	s.lock.Unlock()
+
+	if first && s.drainStarted != nil {
+		close(s.drainStarted)
+	}
+
+	if s.drain != nil {
+		<-s.drain
+	}
+
+	s.lock.Lock()
+	s.draining = false
+	s.lock.Unlock()
+
+	return nil
+}
+
+func (s *fakeSink) output() []int16 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]int16(nil), s.written...)
+}
+
+// constSource is n samples of v at 16kHz.
+type constSource struct {
+	v int16
+	n int
+}
+
+func (s *constSource) SampleRate() int { return 16000 }
+func (s *constSource) Channels() int   { return 1 }
+func (s *constSource) Close() error    { return nil }
+
+func (s *constSource) Read(buf []int16) (int, error) {
+	if s.n == 0 {
+		return 0, io.EOF
+	}
+
+	if len(buf) > s.n {
+		buf = buf[:s.n]
+	}
+
+	for i := range buf {
+		buf[i] = s.v
+	}
+
+	s.n -= len(buf)
+
+	return len(buf), nil
+}
+
+func near(a, b int16) bool {
+	return a-b <= 1 && b-a <= 1
+}
+
+func TestMixerOverlappingTracks(t *testing.T) {
+	var (
+		sink    = &fakeSink{}
+		m       = NewMixer(sink)
+		first   = m.Track()
+		second  = m.Track()
+		started = make(chan struct{})
+		release = make(chan struct{})
+		wg      sync.WaitGroup
+	)
+
+	// Hold up the first block until both tracks are in.
+	sink.onWrite = func(n int) {
+		if n == 1 {
+			close(started)
+			<-release
+		}
+	}
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		first.PlaySource(&constSource{1000, 8 * mixBlock})
+	}()
+
+	<-started
+
+	go func() {
+		defer wg.Done()
+		second.PlaySource(&constSource{2000, 2 * mixBlock})
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		m.lock.Lock()
+		n := len(m.tracks)
+		m.lock.Unlock()
+
+		if n == 2 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("the second track never started")
+		}
+	}
+
+	close(release)
+	wg.Wait()
+
+	var (
+		out   = sink.output()
+		sum   int64
+		mixed int
+	)
+
+	for _, s := range out {
+		sum += int64(s)
+
+		if near(s, 3000) {
+			mixed++
+		}
+	}
+
+	if mixed != 2*mixBlock {
+		t.Errorf("%d samples of the tracks mixed together, want %d", mixed, 2*mixBlock)
+	}
+
+	if want := int64(1000*8*mixBlock + 2000*2*mixBlock); sum < want-int64(len(out)) || sum > want+int64(len(out)) {
+		t.Errorf("output adds up to %d, want %d", sum, want)
+	}
+}
+
+func TestMixerDuckRamp(t *testing.T) {
+	var (
+		sink  = &fakeSink{}
+		m     = NewMixer(sink)
+		track = m.Track()
+	)
+
+	sink.onWrite = func(n int) {
+		if n == 2 {
+			track.SetVolume(DefaultDuckVolume)
+		}
+	}
+
+	track.PlaySource(&constSource{10000, 10 * mixBlock})
+
+	var (
+		out  []int16
+		ramp int
+	)
+
+	// The mixer writes silence while it waits for the track.
+	for _, s := range sink.output() {
+		if s != 0 {
+			out = append(out, s)
+		}
+	}
+
+	for i, s := range out {
+		if i > 0 && s > out[i-1]+1 {
+			t.Fatalf("sample %d went up from %d to %d while ducking", i, out[i-1], s)
+		}
+
+		if s < 10000-1 && s > 2000+1 {
+			ramp++
+		}
+	}
+
+	// The volume moves at a rate that goes all the way in volumeRamp.
+	if want := int((1 - DefaultDuckVolume) * 16000 * volumeRamp.Seconds()); ramp < want-2 || ramp > want+2 {
+		t.Errorf("ducking took %d samples, want %d", ramp, want)
+	}
+
+	if last := out[len(out)-1]; !near(last, 2000) {
+		t.Errorf("ducked to %d, want 2000", last)
+	}
+}
+
+func TestMixerTrackAddedWhileDraining(t *testing.T) {
+	var (
+		sink = &fakeSink{
+			drain:        make(chan struct{}),
+			drainStarted: make(chan struct{}),
+		}
+		m    = NewMixer(sink)
+		done = make(chan struct{})
+	)
+
+	m.Track().PlaySource(&constSource{1000, mixBlock})
+	<-sink.drainStarted
+
+	go func() {
+		defer close(done)
+		m.Track().PlaySource(&constSource{2000, mixBlock})
+	}()
+
+	// Give a second run time to write while the first drains.
+	time.Sleep(50 * time.Millisecond)
+	close(sink.drain)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the track added while draining was never played")
+	}
+
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if sink.overlaps != 0 {
+		t.Errorf("%d blocks written while the sink was draining", sink.overlaps)
+	}
+}
+
+func TestTrackStopBeforePlay(t *testing.T) {
+	var (
+		sink  = &fakeSink{}
+		m     = NewMixer(sink)
+		track = m.Track()
+	)
+
+	// Like a barge-in between Speak being handled and playing.
+	track.Cue()
+	track.Stop()
+	track.PlaySource(&constSource{1000, 100 * mixBlock})
+
+	for _, s := range sink.output() {
+		if s != 0 {
+			t.Fatal("played after being stopped")
+		}
+	}
+
+	// A Stop with nothing cued is for what was playing, not what
+	// comes next.
+	track.Stop()
+	track.PlaySource(&constSource{1000, 2 * mixBlock})
+
+	played := 0
+	for _, s := range sink.output() {
+		if near(s, 1000) {
+			played++
+		}
+	}
+
+	if played != 2*mixBlock {
+		t.Errorf("played %d samples after a stale Stop, want %d", played, 2*mixBlock)
+	}
+}
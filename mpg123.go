@@ -0,0 +1,144 @@
+package alexa
+
+import (
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Mpg123Player hands the mp3 to an external mpg123. It's the fallback
+// for when PortAudio playback misbehaves, at the cost of mpg123 picking
+// the device itself.
+type Mpg123Player struct {
+	lock     sync.Mutex
+	cmd      *exec.Cmd
+	started  time.Time
+	pausedAt time.Time
+	paused   time.Duration
+}
+
+// mp3Frame is how long an mp3 frame is at 44.1kHz, near enough for
+// skipping into a stream whatever its rate.
+const mp3Frame = 1152 * time.Second / 44100
+
+func (m *Mpg123Player) Play(r io.Reader) error {
+	return m.PlayFrom(r, 0)
+}
+
+// PlayFrom plays r starting roughly offset into it.
+func (m *Mpg123Player) PlayFrom(r io.Reader, offset time.Duration) error {
+	m.lock.Lock()
+	m.started = time.Time{}
+	m.lock.Unlock()
+
+	cmd := exec.Command("mpg123", "-q", "-k", strconv.Itoa(int(offset/mp3Frame)), "-")
+	ip, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	m.cmd = cmd
+	m.started = time.Now()
+	m.pausedAt = time.Time{}
+	m.paused = 0
+	m.lock.Unlock()
+
+	io.Copy(ip, r)
+
+	ip.Close()
+
+	err = cmd.Wait()
+
+	m.lock.Lock()
+	killed := m.cmd == nil
+	m.cmd = nil
+	m.lock.Unlock()
+
+	if killed {
+		return nil
+	}
+
+	return err
+}
+
+func (m *Mpg123Player) signal(sig syscall.Signal) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.cmd == nil || m.cmd.Process == nil {
+		return nil
+	}
+
+	return m.cmd.Process.Signal(sig)
+}
+
+func (m *Mpg123Player) Stop() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.cmd == nil || m.cmd.Process == nil {
+		return nil
+	}
+
+	err := m.cmd.Process.Kill()
+	m.cmd = nil
+
+	return err
+}
+
+func (m *Mpg123Player) Pause() error {
+	err := m.signal(syscall.SIGSTOP)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	if m.pausedAt.IsZero() {
+		m.pausedAt = time.Now()
+	}
+	m.lock.Unlock()
+
+	return nil
+}
+
+func (m *Mpg123Player) Resume() error {
+	err := m.signal(syscall.SIGCONT)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	if !m.pausedAt.IsZero() {
+		m.paused += time.Since(m.pausedAt)
+		m.pausedAt = time.Time{}
+	}
+	m.lock.Unlock()
+
+	return nil
+}
+
+// Position is only an estimate, mpg123 doesn't tell.
+func (m *Mpg123Player) Position() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.started.IsZero() {
+		return 0
+	}
+
+	end := time.Now()
+	if !m.pausedAt.IsZero() {
+		end = m.pausedAt
+	}
+
+	return end.Sub(m.started) - m.paused
+}
@@ -0,0 +1,120 @@
+package alexa
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultNoiseWindow is how far back the noise floor looks.
+const DefaultNoiseWindow = 5 * time.Second
+
+// noiseBlocks is how many pieces the noise window is split into; the
+// floor moves up a piece at a time.
+const noiseBlocks = 8
+
+// noiseSmoothing is how much of the smoothed level is kept each frame.
+const noiseSmoothing = 0.8
+
+// initialNoise is the highest the floor is taken to be, in dB, while
+// the first block is being measured and the level isn't steady.
+// Otherwise someone already talking when listening starts, reading
+// from a file or right after the wake word, would count as the noise.
+const initialNoise = -50
+
+// noiseSteady is how far apart the loudest and quietest frames may be,
+// in dB, for the level to be steady like a fan rather than come and go
+// like speech.
+const noiseSteady = 6
+
+// noiseBias makes up for the minimum of a noisy level being below its
+// average, in dB.
+const noiseBias = 1.5
+
+// NoiseFloor estimates the level of the background noise by minimum
+// statistics: speech comes and goes, so the quietest the smoothed
+// level has been over the last few seconds is the noise. A fan or a TV
+// just raises the floor.
+type NoiseFloor struct {
+	// Window is how far back to look. Zero means DefaultNoiseWindow.
+	Window time.Duration
+
+	// SampleRate is what frames are counted in. Zero means 16kHz.
+	SampleRate int
+
+	smoothed float64
+	level    float64
+	started  bool
+	loudest  float64
+	quietest float64
+
+	blocks  []float64
+	current float64
+	counted int
+}
+
+// Update takes the power of the next frame, n samples long, and returns
+// the noise floor, both in dB.
+func (f *NoiseFloor) Update(db float64, n int) float64 {
+	power := math.Pow(10, db/10)
+
+	if !f.started {
+		f.smoothed = power
+		f.current = math.Inf(1)
+		f.quietest = power
+		f.started = true
+	} else {
+		f.smoothed = noiseSmoothing*f.smoothed + (1-noiseSmoothing)*power
+	}
+
+	f.current = math.Min(f.current, f.smoothed)
+	f.counted += n
+
+	window, rate := f.Window, f.SampleRate
+	if window == 0 {
+		window = DefaultNoiseWindow
+	}
+	if rate == 0 {
+		rate = 16000
+	}
+
+	if f.counted >= int(window*time.Duration(rate)/time.Second)/noiseBlocks {
+		f.blocks = append(f.blocks, f.current)
+		if len(f.blocks) > noiseBlocks {
+			f.blocks = f.blocks[:copy(f.blocks, f.blocks[1:])]
+		}
+
+		f.current = math.Inf(1)
+		f.counted = 0
+	}
+
+	floor := f.current
+	for _, b := range f.blocks {
+		floor = math.Min(floor, b)
+	}
+
+	if len(f.blocks) == 0 {
+		f.loudest = math.Max(f.loudest, power)
+		f.quietest = math.Min(f.quietest, power)
+
+		if 10*math.Log10(f.loudest/(f.quietest+1e-12)) > noiseSteady {
+			floor = math.Min(floor, math.Pow(10, (initialNoise-noiseBias)/10))
+		}
+	}
+
+	f.level = 10*math.Log10(floor+1e-12) + noiseBias
+
+	return f.level
+}
+
+// Level is the current noise floor in dB.
+func (f *NoiseFloor) Level() float64 {
+	return f.level
+}
+
+func (f *NoiseFloor) Reset() {
+	*f = NoiseFloor{
+		Window:     f.Window,
+		SampleRate: f.SampleRate,
+		blocks:     f.blocks[:0],
+	}
+}
@@ -0,0 +1,473 @@
+package alexa
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/audio/resample"
+	"github.com/Fruchtgummi/alexa/audio/wav"
+	"github.com/Fruchtgummi/alexa/portaudio"
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// Player plays the mp3s alexa speaks with. Play blocks until the audio
+// is done or Stop is called from elsewhere, so whoever started it can
+// interrupt it.
+type Player interface {
+	Play(r io.Reader) error
+	Stop() error
+	Pause() error
+	Resume() error
+
+	// Position is how far into the current audio playback is.
+	Position() time.Duration
+}
+
+// cuePlayer is a Player that can be readied for the next Play, so that
+// a Stop coming before that Play gets going still stops it.
+type cuePlayer interface {
+	Cue()
+}
+
+// OpenOutput returns what makes the players for a --player flag, one
+// per channel: tracks of a single Mixer on device for "portaudio", so
+// they can be heard together and ducked, or separate mpg123s.
+func OpenOutput(name, device string) (func() Player, error) {
+	if name == "mpg123" {
+		return func() Player { return &Mpg123Player{} }, nil
+	}
+
+	sink, err := NewPortAudioSink(device)
+	if err != nil {
+		return nil, err
+	}
+
+	m := NewMixer(sink)
+
+	return func() Player { return m.Track() }, nil
+}
+
+// PortAudioPlayer decodes mp3 itself and plays it on an output device
+// through PortAudio.
+type PortAudioPlayer struct {
+	// Device picks the output device, see FindDevice.
+	Device string
+
+	lock    sync.Mutex
+	cond    *sync.Cond
+	paused  bool
+	stopped bool
+	cued    bool
+	volume  float64
+	frames  int64
+	rate    float64
+	stats   portaudio.StreamStats
+	playing bool
+	levels  []float64
+}
+
+// levelHistory is how many blocks Level looks back over, about a
+// quarter of a second at 44.1kHz.
+const levelHistory = 12
+
+func NewPortAudioPlayer(device string) *PortAudioPlayer {
+	p := &PortAudioPlayer{Device: device, volume: 1}
+	p.cond = sync.NewCond(&p.lock)
+	return p
+}
+
+// SetVolume scales the output, 0 being silent and 1 as loud as the
+// mp3 itself.
+func (p *PortAudioPlayer) SetVolume(v float64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.volume = v
+}
+
+func (p *PortAudioPlayer) Stop() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.stopped = true
+	p.cond.Broadcast()
+
+	return nil
+}
+
+// Cue readies p for the next Play: a Stop from now on stops it, even if
+// it comes first.
+func (p *PortAudioPlayer) Cue() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.stopped = false
+	p.cued = true
+}
+
+func (p *PortAudioPlayer) Pause() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.paused = true
+
+	return nil
+}
+
+func (p *PortAudioPlayer) Resume() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.paused = false
+	p.cond.Broadcast()
+
+	return nil
+}
+
+// Stats are the stream stats of what was played last, or of what is
+// playing now.
+func (p *PortAudioPlayer) Stats() portaudio.StreamStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.stats
+}
+
+// Level is the loudest the output has been lately, in dB, so that
+// BargeIn can tell it from the user.
+func (p *PortAudioPlayer) Level() float64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	level := float64(silenceLevel)
+
+	if !p.playing || p.paused {
+		return level
+	}
+
+	for _, l := range p.levels {
+		level = math.Max(level, l)
+	}
+
+	return level
+}
+
+func (p *PortAudioPlayer) Position() time.Duration {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.rate == 0 {
+		return 0
+	}
+
+	return time.Duration(float64(p.frames) / p.rate * float64(time.Second))
+}
+
+func (p *PortAudioPlayer) Play(r io.Reader) error {
+	return p.PlayFrom(r, 0)
+}
+
+// PlayFrom plays r starting offset into it. Position counts from
+// there.
+func (p *PortAudioPlayer) PlayFrom(r io.Reader, offset time.Duration) error {
+	// A Stop from here on, or since Cue, stops this, even before the
+	// stream is open.
+	p.lock.Lock()
+	if !p.cued {
+		p.stopped = false
+	}
+
+	p.cued = false
+	p.paused = false
+	p.frames = 0
+	p.lock.Unlock()
+
+	dec, err := mp3.NewDecoder(r)
+	if err != nil {
+		return err
+	}
+
+	err = skipMP3(dec, offset)
+	if err != nil {
+		return err
+	}
+
+	out, err := p.openOutput()
+	if err != nil {
+		return err
+	}
+
+	defer out.close()
+
+	var (
+		conv = newPCMConverter(float64(dec.SampleRate()), out.rate, out.channels)
+		raw  = make([]byte, 4096)
+	)
+
+	return p.play(out, func(dst []float64) ([]float64, error) {
+		n, err := dec.Read(raw)
+		if err != nil && err != io.EOF {
+			return dst, err
+		}
+
+		return conv.convert(dst, raw[:n-n%4], err == io.EOF), err
+	})
+}
+
+// outputStream is the blocking stream PortAudioPlayer plays on.
+type outputStream interface {
+	Start() error
+	Stop() error
+	Abort() error
+	Write() error
+	Stats() portaudio.StreamStats
+}
+
+// playerOutput is an outputStream open to play on: Write plays buf,
+// frames of channels samples at rate.
+type playerOutput struct {
+	outputStream
+
+	buf      []int16
+	rate     float64
+	channels int
+	close    func()
+}
+
+// openOutput opens Device to play on.
+func (p *PortAudioPlayer) openOutput() (*playerOutput, error) {
+	err := portaudio.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	dev, err := FindDevice(p.Device, false)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, err
+	}
+
+	params := OutputParameters(dev)
+	params.FramesPerBuffer = 1024
+
+	out := &playerOutput{
+		buf:      make([]int16, params.FramesPerBuffer*params.Output.Channels),
+		rate:     params.SampleRate,
+		channels: params.Output.Channels,
+	}
+
+	stream, err := portaudio.OpenStream(params, out.buf)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, err
+	}
+
+	out.outputStream = stream
+	out.close = func() {
+		stream.Close()
+		portaudio.Terminate()
+	}
+
+	return out, nil
+}
+
+// play plays what read gives, converted to the output, until it
+// returns io.EOF or the player is stopped.
+func (p *PortAudioPlayer) play(o *playerOutput, read func([]float64) ([]float64, error)) error {
+	p.lock.Lock()
+	if p.stopped {
+		p.lock.Unlock()
+		return nil
+	}
+
+	p.rate = o.rate
+	p.stats = portaudio.StreamStats{}
+	p.playing = true
+	p.levels = p.levels[:0]
+	p.lock.Unlock()
+
+	defer func() {
+		p.lock.Lock()
+		p.playing = false
+		p.lock.Unlock()
+	}()
+
+	err := o.Start()
+	if err != nil {
+		return err
+	}
+
+	var (
+		out     = o.buf
+		pending []float64
+		done    bool
+	)
+
+	for {
+		for !done && len(pending) < len(out) {
+			pending, err = read(pending)
+
+			if err != nil && err != io.EOF {
+				o.Abort()
+				return err
+			}
+
+			done = err == io.EOF
+		}
+
+		if len(pending) == 0 {
+			break
+		}
+
+		stopped, volume := p.wait(o)
+		if stopped {
+			return o.Abort()
+		}
+
+		n := copy64(out, pending, volume)
+		for i := n; i < len(out); i++ {
+			out[i] = 0
+		}
+
+		pending = pending[:copy(pending, pending[n:])]
+
+		// An underflow is a glitch that's already been heard; it's
+		// counted by the stream, so carry on.
+		err = o.Write()
+		if err != nil && err != portaudio.ErrOutputUnderflowed {
+			return err
+		}
+
+		p.lock.Lock()
+		p.frames += int64(n / o.channels)
+		p.stats = o.Stats()
+		p.levels = append(p.levels, decibels(out))
+		if len(p.levels) > levelHistory {
+			p.levels = p.levels[:copy(p.levels, p.levels[1:])]
+		}
+		p.lock.Unlock()
+	}
+
+	return o.Stop()
+}
+
+// wait holds playback while it's paused, returning whether it has been
+// stopped and the volume to play at.
+func (p *PortAudioPlayer) wait(stream outputStream) (bool, float64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.paused && !p.stopped {
+		stream.Stop()
+
+		for p.paused && !p.stopped {
+			p.cond.Wait()
+		}
+
+		if !p.stopped {
+			stream.Start()
+		}
+	}
+
+	return p.stopped, p.volume
+}
+
+func copy64(dst []int16, src []float64, volume float64) int {
+	n := len(dst)
+	if len(src) < n {
+		n = len(src)
+	}
+
+	for i := 0; i < n; i++ {
+		dst[i] = wav.ToInt16(src[i] * volume)
+	}
+
+	return n
+}
+
+// pcmConverter turns the 16 bit stereo the mp3 decoder produces into
+// interleaved samples at the rate and channel count of the output.
+type pcmConverter struct {
+	channels int
+	rs       [2]*resample.Resampler
+	in       [2][]float64
+	out      [2][]float64
+}
+
+func newPCMConverter(from, to float64, channels int) *pcmConverter {
+	c := &pcmConverter{channels: channels}
+
+	if from != to {
+		c.rs[0] = resample.New(from, to)
+		c.rs[1] = resample.New(from, to)
+	}
+
+	return c
+}
+
+func (c *pcmConverter) convert(dst []float64, b []byte, flush bool) []float64 {
+	c.in[0], c.in[1] = c.in[0][:0], c.in[1][:0]
+
+	for i := 0; i+4 <= len(b); i += 4 {
+		c.in[0] = append(c.in[0], float64(int16(binary.LittleEndian.Uint16(b[i:])))/(1<<15))
+		c.in[1] = append(c.in[1], float64(int16(binary.LittleEndian.Uint16(b[i+2:])))/(1<<15))
+	}
+
+	return c.output(dst, flush)
+}
+
+// convertSamples is convert for interleaved samples with any number of
+// channels. Mono is played on both sides.
+func (c *pcmConverter) convertSamples(dst []float64, samples []int16, channels int, flush bool) []float64 {
+	c.in[0], c.in[1] = c.in[0][:0], c.in[1][:0]
+
+	for i := 0; i+channels <= len(samples); i += channels {
+		l := float64(samples[i]) / (1 << 15)
+		r := l
+
+		if channels > 1 {
+			r = float64(samples[i+1]) / (1 << 15)
+		}
+
+		c.in[0] = append(c.in[0], l)
+		c.in[1] = append(c.in[1], r)
+	}
+
+	return c.output(dst, flush)
+}
+
+// output resamples what's in c.in and appends it to dst, interleaved.
+func (c *pcmConverter) output(dst []float64, flush bool) []float64 {
+	for ch := range c.in {
+		if c.rs[ch] == nil {
+			c.out[ch] = append(c.out[ch][:0], c.in[ch]...)
+			continue
+		}
+
+		c.out[ch] = c.rs[ch].Process(c.out[ch][:0], c.in[ch])
+
+		if flush {
+			c.out[ch] = c.rs[ch].Flush(c.out[ch])
+		}
+	}
+
+	for i := range c.out[0] {
+		l, r := c.out[0][i], c.out[1][i]
+
+		switch c.channels {
+		case 1:
+			dst = append(dst, (l+r)/2)
+		default:
+			dst = append(dst, l, r)
+
+			for ch := 2; ch < c.channels; ch++ {
+				dst = append(dst, 0)
+			}
+		}
+	}
+
+	return dst
+}
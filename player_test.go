@@ -0,0 +1,201 @@
+package alexa
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/portaudio"
+)
+
+// fakeStream takes a millisecond over every write, and counts what
+// PortAudioPlayer does with it.
+type fakeStream struct {
+	lock    sync.Mutex
+	writes  int
+	starts  int
+	stops   int
+	aborted bool
+}
+
+func (s *fakeStream) Start() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.starts++
+	return nil
+}
+
+func (s *fakeStream) Stop() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.stops++
+	return nil
+}
+
+func (s *fakeStream) Abort() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.aborted = true
+	return nil
+}
+
+func (s *fakeStream) Write() error {
+	time.Sleep(time.Millisecond)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.writes++
+	return nil
+}
+
+func (s *fakeStream) Stats() portaudio.StreamStats { return portaudio.StreamStats{} }
+
+func (s *fakeStream) count() (writes, starts, stops int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.writes, s.starts, s.stops
+}
+
+// playConst plays n samples at 16kHz mono on p through s, 160 at a
+// time, and sends what play returns once it has finished.
+func playConst(p *PortAudioPlayer, s *fakeStream, n int) <-chan error {
+	var (
+		out  = &playerOutput{outputStream: s, buf: make([]int16, 160), rate: 16000, channels: 1}
+		src  = &constSource{1000, n}
+		in   = make([]int16, 160)
+		done = make(chan error, 1)
+	)
+
+	go func() {
+		done <- p.play(out, func(dst []float64) ([]float64, error) {
+			n, err := src.Read(in)
+			for _, v := range in[:n] {
+				dst = append(dst, float64(v)/(1<<15))
+			}
+
+			return dst, err
+		})
+	}()
+
+	return done
+}
+
+// waitWrites waits for s to have been written to n times.
+func waitWrites(t *testing.T, s *fakeStream, n int) {
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if w, _, _ := s.count(); w >= n {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("the stream was never written to %d times", n)
+		}
+	}
+}
+
+func TestPortAudioPlayerPosition(t *testing.T) {
+	var (
+		p = NewPortAudioPlayer("")
+		s = &fakeStream{}
+	)
+
+	err := <-playConst(p, s, 16000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pos := p.Position(); pos != time.Second {
+		t.Errorf("a second of audio ended at %v", pos)
+	}
+
+	if w, _, stops := s.count(); w != 100 || stops != 1 {
+		t.Errorf("%d writes and %d stops, want 100 and 1", w, stops)
+	}
+}
+
+func TestPortAudioPlayerPauseResume(t *testing.T) {
+	var (
+		p    = NewPortAudioPlayer("")
+		s    = &fakeStream{}
+		done = playConst(p, s, 16000)
+	)
+
+	waitWrites(t, s, 10)
+	p.Pause()
+
+	// Give it time to notice, then see it stays put.
+	time.Sleep(20 * time.Millisecond)
+
+	var (
+		w, _, stops = s.count()
+		pos         = p.Position()
+	)
+
+	time.Sleep(50 * time.Millisecond)
+
+	if w2, _, _ := s.count(); w2 != w || p.Position() != pos {
+		t.Fatalf("went on from %d to %d writes while paused", w, w2)
+	}
+
+	if stops != 1 || p.Level() != silenceLevel {
+		t.Errorf("paused with %d stream stops, level %.0f", stops, p.Level())
+	}
+
+	p.Resume()
+
+	err := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, starts, _ := s.count(); starts != 2 {
+		t.Errorf("the stream was started %d times, want again on Resume", starts)
+	}
+
+	if pos := p.Position(); pos != time.Second {
+		t.Errorf("a second of audio with a pause in it ended at %v", pos)
+	}
+}
+
+func TestPortAudioPlayerStop(t *testing.T) {
+	var (
+		p    = NewPortAudioPlayer("")
+		s    = &fakeStream{}
+		done = playConst(p, s, 10*16000)
+	)
+
+	waitWrites(t, s, 10)
+	p.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop didn't stop it")
+	}
+
+	if !s.aborted || p.Position() >= 10*time.Second {
+		t.Errorf("stopped at %v, aborted %v", p.Position(), s.aborted)
+	}
+
+	// Stopped while paused stops too.
+	p.Cue()
+	done = playConst(p, s, 10*16000)
+
+	waitWrites(t, s, 20)
+	p.Pause()
+	p.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop didn't stop it while paused")
+	}
+}
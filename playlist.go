@@ -0,0 +1,260 @@
+package alexa
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Fruchtgummi/alexa/directives"
+)
+
+// maxPlaylist is the most of a playlist that is read, and
+// maxPlaylistDepth how many playlists deep a stream may be.
+const (
+	maxPlaylist      = 64 << 10
+	maxPlaylistDepth = 4
+)
+
+var (
+	// ErrHLS is returned for HTTP Live Streaming playlists, which
+	// aren't supported.
+	ErrHLS = errors.New("HLS playlists are not supported")
+
+	// ErrNoFFmpeg is returned for AAC streams when there's no ffmpeg
+	// on the PATH to turn them into mp3.
+	ErrNoFFmpeg = errors.New("AAC streams need ffmpeg, which isn't installed")
+)
+
+// HTTPError is a stream that couldn't be fetched.
+type HTTPError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s: %s", e.URL, http.StatusText(e.StatusCode))
+}
+
+// streamKind is what's at the end of a stream URL.
+type streamKind int
+
+const (
+	mp3Stream streamKind = iota
+	aacStream
+	m3uPlaylist
+	plsPlaylist
+)
+
+// kindOf decides what a stream is from its content type, or failing
+// that its URL.
+func kindOf(u *url.URL, contentType string) streamKind {
+	mt, _, _ := mime.ParseMediaType(contentType)
+
+	switch mt {
+	case "audio/x-mpegurl", "audio/mpegurl", "application/x-mpegurl", "application/vnd.apple.mpegurl":
+		return m3uPlaylist
+	case "audio/x-scpls", "application/pls+xml":
+		return plsPlaylist
+	case "audio/aac", "audio/aacp", "audio/x-aac", "audio/mp4", "audio/x-m4a":
+		return aacStream
+	case "audio/mpeg", "audio/mp3":
+		return mp3Stream
+	}
+
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".m3u", ".m3u8":
+		return m3uPlaylist
+	case ".pls":
+		return plsPlaylist
+	case ".aac", ".m4a", ".mp4":
+		return aacStream
+	}
+
+	return mp3Stream
+}
+
+// openStream opens the audio of s as mp3: the content that came along
+// with it, or whatever its URL points to, following playlists. AAC
+// streams, which a lot of radio stations send, are transcoded by
+// ffmpeg, so they need it installed.
+func openStream(ctx context.Context, client *http.Client, s directives.Stream) (io.ReadCloser, error) {
+	if s.Audio != nil {
+		return ioutil.NopCloser(bytes.NewReader(s.Audio)), nil
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return fetchStream(ctx, client, s.URL, 0)
+}
+
+func fetchStream(ctx context.Context, client *http.Client, rawurl string, depth int) (io.ReadCloser, error) {
+	if depth > maxPlaylistDepth {
+		return nil, fmt.Errorf("%s: playlists nested too deep", rawurl)
+	}
+
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &HTTPError{URL: rawurl, StatusCode: resp.StatusCode}
+	}
+
+	var entries []string
+
+	switch kindOf(req.URL, resp.Header.Get("Content-Type")) {
+	case mp3Stream:
+		return resp.Body, nil
+	case aacStream:
+		return transcodeAAC(resp.Body)
+	case m3uPlaylist:
+		entries, err = parseM3U(io.LimitReader(resp.Body, maxPlaylist))
+	case plsPlaylist:
+		entries, err = parsePLS(io.LimitReader(resp.Body, maxPlaylist))
+	}
+
+	resp.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: empty playlist", rawurl)
+	}
+
+	// Radio playlists list mirrors; take the first that works.
+	for _, entry := range entries {
+		u, perr := req.URL.Parse(entry)
+		if perr != nil {
+			err = perr
+			continue
+		}
+
+		var r io.ReadCloser
+
+		r, err = fetchStream(ctx, client, u.String(), depth+1)
+		if err == nil {
+			return r, nil
+		}
+	}
+
+	return nil, err
+}
+
+// parseM3U returns the entries of an M3U playlist.
+func parseM3U(r io.Reader) ([]string, error) {
+	var entries []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-"):
+			return nil, ErrHLS
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			entries = append(entries, line)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// parsePLS returns the entries of a PLS playlist, in the order of
+// their numbers.
+func parsePLS(r io.Reader) ([]string, error) {
+	files := make(map[int]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		kv := strings.SplitN(strings.TrimSpace(scanner.Text()), "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(strings.ToLower(kv[0]), "file") {
+			continue
+		}
+
+		n, err := strconv.Atoi(kv[0][len("file"):])
+		if err != nil {
+			continue
+		}
+
+		files[n] = strings.TrimSpace(kv[1])
+	}
+
+	var numbers []int
+	for n := range files {
+		numbers = append(numbers, n)
+	}
+
+	sort.Ints(numbers)
+
+	var entries []string
+	for _, n := range numbers {
+		entries = append(entries, files[n])
+	}
+
+	return entries, scanner.Err()
+}
+
+// transcodeAAC has ffmpeg turn an AAC stream into mp3, which is what
+// the players take. Without ffmpeg it fails with ErrNoFFmpeg.
+func transcodeAAC(r io.ReadCloser) (io.ReadCloser, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		r.Close()
+		return nil, ErrNoFFmpeg
+	}
+
+	cmd := exec.Command(ffmpeg, "-loglevel", "error", "-i", "pipe:0", "-f", "mp3", "pipe:1")
+	cmd.Stdin = r
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("ffmpeg: %s", err)
+	}
+
+	return &transcoder{ReadCloser: out, cmd: cmd, src: r}, nil
+}
+
+type transcoder struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+	src io.Closer
+}
+
+func (t *transcoder) Close() error {
+	t.src.Close()
+	t.cmd.Process.Kill()
+	t.cmd.Wait()
+
+	return nil
+}
@@ -22,6 +22,7 @@ import (
 	"reflect"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 )
@@ -71,6 +72,14 @@ const (
 	BadBufferPtr                          Error = C.paBadBufferPtr
 )
 
+// ErrInputOverflowed and ErrOutputUnderflowed are returned by Read and
+// Write when audio was lost because the stream wasn't read or written
+// in time. The read or write itself still happened.
+var (
+	ErrInputOverflowed   error = InputOverflowed
+	ErrOutputUnderflowed error = OutputUnderflowed
+)
+
 type UnanticipatedHostError struct {
 	HostApiType HostApiType
 	Code        int
@@ -434,6 +443,8 @@ func IsFormatSupported(p StreamParameters, args ...interface{}) error {
 type Int24 [3]byte
 
 type Stream struct {
+	// counters come first to keep them 64 bit aligned for atomic.
+	counters            streamCounters
 	id                  uintptr
 	paStream            unsafe.Pointer
 	inParams, outParams *C.PaStreamParameters
@@ -740,6 +751,7 @@ func streamCallback(inputBuffer, outputBuffer unsafe.Pointer, frames C.ulong, ti
 	s := scm.Get(uintptr(userData))
 	s.timeInfo = StreamCallbackTimeInfo{duration(timeInfo.inputBufferAdcTime), duration(timeInfo.currentTime), duration(timeInfo.outputBufferDacTime)}
 	s.flags = StreamCallbackFlags(statusFlags)
+	s.counters.count(s.flags)
 	updateBuffer(s.in, uintptr(inputBuffer), s.inParams, int(frames))
 	updateBuffer(s.out, uintptr(outputBuffer), s.outParams, int(frames))
 	s.callback.Call(s.args)
@@ -792,6 +804,66 @@ type StreamInfo struct {
 	SampleRate                  float64
 }
 
+type streamCounters struct {
+	inputUnderflows, inputOverflows, outputUnderflows, outputOverflows uint64
+}
+
+func (c *streamCounters) count(flags StreamCallbackFlags) {
+	if flags&InputUnderflow != 0 {
+		atomic.AddUint64(&c.inputUnderflows, 1)
+	}
+	if flags&InputOverflow != 0 {
+		atomic.AddUint64(&c.inputOverflows, 1)
+	}
+	if flags&OutputUnderflow != 0 {
+		atomic.AddUint64(&c.outputUnderflows, 1)
+	}
+	if flags&OutputOverflow != 0 {
+		atomic.AddUint64(&c.outputOverflows, 1)
+	}
+}
+
+// counted counts err if it's an overflow or underflow from Read or Write of a blocking stream, and returns it.
+func (c *streamCounters) counted(err error) error {
+	switch err {
+	case ErrInputOverflowed:
+		atomic.AddUint64(&c.inputOverflows, 1)
+	case ErrOutputUnderflowed:
+		atomic.AddUint64(&c.outputUnderflows, 1)
+	}
+	return err
+}
+
+func (c *streamCounters) stats() StreamStats {
+	return StreamStats{
+		InputUnderflows:  atomic.LoadUint64(&c.inputUnderflows),
+		InputOverflows:   atomic.LoadUint64(&c.inputOverflows),
+		OutputUnderflows: atomic.LoadUint64(&c.outputUnderflows),
+		OutputOverflows:  atomic.LoadUint64(&c.outputOverflows),
+	}
+}
+
+/*
+StreamStats is a snapshot of how a stream is doing.  The counters are cumulative since the stream was opened, from the flags passed to the callback of a callback stream or the errors returned by Read and Write of a blocking one.
+*/
+type StreamStats struct {
+	InputUnderflows, InputOverflows, OutputUnderflows, OutputOverflows uint64
+
+	// CpuLoad is the fraction of the time available that the callback takes, 0 for blocking streams.
+	CpuLoad float64
+
+	StreamInfo
+}
+
+func (s *Stream) Stats() StreamStats {
+	st := s.counters.stats()
+	st.CpuLoad = s.CpuLoad()
+	if i := s.Info(); i != nil {
+		st.StreamInfo = *i
+	}
+	return st
+}
+
 func (s *Stream) Time() time.Duration {
 	return duration(C.Pa_GetStreamTime(s.paStream))
 }
@@ -830,7 +902,7 @@ func (s *Stream) Read() error {
 	if err != nil {
 		return err
 	}
-	return newError(C.Pa_ReadStream(s.paStream, buf, C.ulong(frames)))
+	return s.counters.counted(newError(C.Pa_ReadStream(s.paStream, buf, C.ulong(frames))))
 }
 
 /*
@@ -847,7 +919,7 @@ func (s *Stream) Write() error {
 	if err != nil {
 		return err
 	}
-	return newError(C.Pa_WriteStream(s.paStream, buf, C.ulong(frames)))
+	return s.counters.counted(newError(C.Pa_WriteStream(s.paStream, buf, C.ulong(frames))))
 }
 
 func getBuffer(s *reflect.SliceHeader, p *C.PaStreamParameters) (unsafe.Pointer, int, error) {
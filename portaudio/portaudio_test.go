@@ -0,0 +1,38 @@
+package portaudio
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStreamCountersFlags(t *testing.T) {
+	var c streamCounters
+
+	c.count(InputOverflow)
+	c.count(InputOverflow | OutputUnderflow)
+	c.count(InputUnderflow | OutputOverflow)
+	c.count(0)
+
+	want := StreamStats{InputUnderflows: 1, InputOverflows: 2, OutputUnderflows: 1, OutputOverflows: 1}
+	if got := c.stats(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestStreamCountersErrors(t *testing.T) {
+	var (
+		c     streamCounters
+		other = errors.New("other")
+	)
+
+	for _, err := range []error{ErrInputOverflowed, ErrInputOverflowed, ErrOutputUnderflowed, other, nil} {
+		if got := c.counted(err); got != err {
+			t.Errorf("counted(%v) returned %v", err, got)
+		}
+	}
+
+	want := StreamStats{InputOverflows: 2, OutputUnderflows: 1}
+	if got := c.stats(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,122 @@
+package alexa
+
+import "sync/atomic"
+
+// Ring is a ring buffer of samples for one goroutine to write and one
+// to read without either ever waiting on the other. It holds the most
+// recent samples written: when the reader falls behind, the oldest are
+// overwritten and counted as dropped.
+type Ring struct {
+	buf []int16
+
+	// write and read count samples since the start; only the writer
+	// moves write and only the reader moves read. writing is where the
+	// writer will have got to once it's done copying, so the reader
+	// knows what may be overwritten under it.
+	write   uint64
+	writing uint64
+	read    uint64
+
+	dropped uint64
+}
+
+func NewRing(size int) *Ring {
+	return &Ring{buf: make([]int16, size)}
+}
+
+// Cap is how many samples the ring holds.
+func (r *Ring) Cap() int {
+	return len(r.buf)
+}
+
+// Write adds samples, overwriting the oldest if the ring is full.
+func (r *Ring) Write(samples []int16) {
+	if len(r.buf) == 0 {
+		return
+	}
+
+	w := atomic.LoadUint64(&r.write)
+
+	if skip := len(samples) - len(r.buf); skip > 0 {
+		samples = samples[skip:]
+		w += uint64(skip)
+	}
+
+	atomic.StoreUint64(&r.writing, w+uint64(len(samples)))
+
+	pos := int(w % uint64(len(r.buf)))
+
+	n := copy(r.buf[pos:], samples)
+	copy(r.buf, samples[n:])
+
+	atomic.StoreUint64(&r.write, w+uint64(len(samples)))
+}
+
+// Len is how many samples there are to read.
+func (r *Ring) Len() int {
+	w := atomic.LoadUint64(&r.write)
+	rd := atomic.LoadUint64(&r.read)
+
+	if n := w - rd; n < uint64(len(r.buf)) {
+		return int(n)
+	}
+
+	return len(r.buf)
+}
+
+// Read takes the oldest samples there are into buf and returns how
+// many.
+func (r *Ring) Read(buf []int16) int {
+	if len(r.buf) == 0 {
+		return 0
+	}
+
+	size := uint64(len(r.buf))
+
+	w := atomic.LoadUint64(&r.write)
+	rd := atomic.LoadUint64(&r.read)
+
+	if w-rd > size {
+		atomic.AddUint64(&r.dropped, w-rd-size)
+		rd = w - size
+	}
+
+	n := w - rd
+	if n > uint64(len(buf)) {
+		n = uint64(len(buf))
+	}
+
+	pos := int(rd % size)
+
+	c := copy(buf[:n], r.buf[pos:])
+	copy(buf[c:n], r.buf)
+
+	// Anything the writer got to while we were copying is garbage;
+	// drop it from the front.
+	if w2 := atomic.LoadUint64(&r.writing); w2-rd > size {
+		lost := w2 - rd - size
+		if lost > n {
+			lost = n
+		}
+
+		copy(buf, buf[lost:n])
+		n -= lost
+		rd += lost
+
+		atomic.AddUint64(&r.dropped, lost)
+	}
+
+	atomic.StoreUint64(&r.read, rd+n)
+
+	return int(n)
+}
+
+// Discard throws away everything there is to read.
+func (r *Ring) Discard() {
+	atomic.StoreUint64(&r.read, atomic.LoadUint64(&r.write))
+}
+
+// Dropped is how many samples were overwritten before they were read.
+func (r *Ring) Dropped() uint64 {
+	return atomic.LoadUint64(&r.dropped)
+}
@@ -0,0 +1,76 @@
+package alexa
+
+import (
+	"fmt"
+	"testing"
+)
+
+// counting is n samples counting up from first.
+func counting(first, n int) []int16 {
+	out := make([]int16, n)
+	for i := range out {
+		out[i] = int16(first + i)
+	}
+
+	return out
+}
+
+func TestRingWrapsAround(t *testing.T) {
+	var (
+		r   = NewRing(8)
+		buf = make([]int16, 8)
+	)
+
+	r.Write(counting(0, 5))
+
+	if n := r.Read(buf[:3]); fmt.Sprint(buf[:n]) != "[0 1 2]" {
+		t.Fatalf("read %v, want [0 1 2]", buf[:n])
+	}
+
+	// This goes past the end of the buffer and back round.
+	r.Write(counting(5, 5))
+
+	if r.Len() != 7 {
+		t.Errorf("Len is %d, want 7", r.Len())
+	}
+
+	if n := r.Read(buf); fmt.Sprint(buf[:n]) != "[3 4 5 6 7 8 9]" {
+		t.Errorf("read %v, want [3 4 5 6 7 8 9]", buf[:n])
+	}
+
+	if r.Dropped() != 0 {
+		t.Errorf("%d dropped, want none", r.Dropped())
+	}
+}
+
+func TestRingKeepsTheNewest(t *testing.T) {
+	var (
+		r   = NewRing(8)
+		buf = make([]int16, 8)
+	)
+
+	r.Write(counting(0, 6))
+	r.Write(counting(6, 6))
+
+	if n := r.Read(buf); fmt.Sprint(buf[:n]) != "[4 5 6 7 8 9 10 11]" {
+		t.Errorf("read %v, want [4 5 6 7 8 9 10 11]", buf[:n])
+	}
+
+	if r.Dropped() != 4 {
+		t.Errorf("%d dropped, want 4", r.Dropped())
+	}
+
+	// More than it holds in one go.
+	r.Write(counting(100, 20))
+
+	if n := r.Read(buf); fmt.Sprint(buf[:n]) != "[112 113 114 115 116 117 118 119]" {
+		t.Errorf("read %v, want the last 8 written", buf[:n])
+	}
+
+	r.Write(counting(0, 3))
+	r.Discard()
+
+	if n := r.Read(buf); n != 0 {
+		t.Errorf("read %v after Discard", buf[:n])
+	}
+}
@@ -0,0 +1,354 @@
+package alexa
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/audio/resample"
+	"github.com/Fruchtgummi/alexa/audio/wav"
+)
+
+// AudioSource is anywhere audio comes from: the microphone, a file,
+// or something made up on the spot for a test.
+type AudioSource interface {
+	// SampleRate is in Hz.
+	SampleRate() int
+	Channels() int
+
+	// Read fills buf with interleaved int16 samples, returning how many
+	// it read. It returns io.EOF once there is no more audio.
+	Read(buf []int16) (int, error)
+
+	Close() error
+}
+
+// readFull reads from src until buf is full. A source that ends part
+// way through leaves the rest of buf zeroed and returns
+// io.ErrUnexpectedEOF.
+func readFull(src AudioSource, buf []int16) error {
+	var got int
+
+	for got < len(buf) {
+		n, err := src.Read(buf[got:])
+		got += n
+
+		if err != nil {
+			if err == io.EOF && got > 0 {
+				for i := got; i < len(buf); i++ {
+					buf[i] = 0
+				}
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OpenInput opens the source named by an --input flag: "" is the
+// microphone picked by device (see OpenCapture), "-" is raw 16kHz
+// mono L16 on stdin and anything else is a WAV file.
+func OpenInput(name, device string) (AudioSource, error) {
+	switch name {
+	case "":
+		return OpenCapture(device, 0)
+	case "-":
+		return NewRawSource(os.Stdin, 16000, 1), nil
+	default:
+		return OpenWAVSource(name)
+	}
+}
+
+// l16Source downmixes and resamples another source to 16kHz mono.
+type l16Source struct {
+	src AudioSource
+	rs  *resample.Resampler
+	in  []int16
+	raw []float64
+	pcm []float64
+	out []float64
+	pos int
+	err error
+}
+
+// NewL16Source returns src converted to 16kHz mono, or src itself if
+// that's what it already is.
+func NewL16Source(src AudioSource) AudioSource {
+	if src.SampleRate() == 16000 && src.Channels() == 1 {
+		return src
+	}
+
+	return &l16Source{
+		src: src,
+		rs:  resample.New(float64(src.SampleRate()), 16000),
+		in:  make([]int16, 1024*src.Channels()),
+	}
+}
+
+func (s *l16Source) SampleRate() int { return 16000 }
+func (s *l16Source) Channels() int   { return 1 }
+
+func (s *l16Source) Read(buf []int16) (int, error) {
+	for s.pos == len(s.out) {
+		if s.err != nil {
+			return 0, s.err
+		}
+
+		n, err := s.src.Read(s.in)
+
+		n -= n % s.src.Channels()
+
+		s.raw = s.raw[:0]
+		for _, v := range s.in[:n] {
+			s.raw = append(s.raw, float64(v)/(1<<15))
+		}
+
+		s.pcm = resample.Downmix(s.pcm[:0], s.raw, s.src.Channels())
+		s.out = s.rs.Process(s.out[:0], s.pcm)
+		s.pos = 0
+
+		if err != nil {
+			if err == io.EOF {
+				s.out = s.rs.Flush(s.out)
+			}
+
+			s.err = err
+		}
+	}
+
+	n := 0
+	for n < len(buf) && s.pos < len(s.out) {
+		buf[n] = wav.ToInt16(s.out[s.pos])
+		n++
+		s.pos++
+	}
+
+	return n, nil
+}
+
+func (s *l16Source) Close() error {
+	return s.src.Close()
+}
+
+// RawSource reads little endian int16 samples from a reader, such as
+// stdin.
+type RawSource struct {
+	r        io.Reader
+	rate     int
+	channels int
+	bytes    []byte
+
+	// odd is 1 when the last read ended half way through a sample,
+	// whose first byte is then kept at the start of bytes.
+	odd int
+}
+
+func NewRawSource(r io.Reader, rate, channels int) *RawSource {
+	return &RawSource{r: r, rate: rate, channels: channels}
+}
+
+func (s *RawSource) SampleRate() int { return s.rate }
+func (s *RawSource) Channels() int   { return s.channels }
+
+func (s *RawSource) Read(buf []int16) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	if cap(s.bytes) < 2*len(buf) {
+		bytes := make([]byte, 2*len(buf))
+		copy(bytes, s.bytes[:s.odd])
+		s.bytes = bytes
+	}
+
+	b := s.bytes[:2*len(buf)]
+
+	// A pipe can hand over an odd number of bytes; the odd one out is
+	// kept for the next read so the samples stay lined up.
+	n, err := io.ReadAtLeast(s.r, b[s.odd:], 2-s.odd)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	n += s.odd
+
+	samples := n / 2
+
+	for i := 0; i < samples; i++ {
+		buf[i] = int16(binary.LittleEndian.Uint16(b[2*i:]))
+	}
+
+	s.odd = n % 2
+	if s.odd == 1 {
+		b[0] = b[n-1]
+	}
+
+	if samples > 0 {
+		return samples, nil
+	}
+
+	return 0, err
+}
+
+func (s *RawSource) Close() error {
+	if c, ok := s.r.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// WAVSource reads a WAV file of any format, converted to 16kHz mono.
+type WAVSource struct {
+	*wav.Converter
+	r *wav.Reader
+}
+
+func OpenWAVSource(path string) (*WAVSource, error) {
+	r, err := wav.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WAVSource{Converter: wav.NewConverter(r), r: r}, nil
+}
+
+func (s *WAVSource) Close() error {
+	return s.r.Close()
+}
+
+// Segment is one stretch of a GeneratorSource.
+type Segment struct {
+	Duration time.Duration
+
+	// Frequency of a sine tone, in Hz. Zero gives no tone.
+	Frequency float64
+
+	// Amplitude of the tone, from 0 to 1.
+	Amplitude float64
+
+	// Noise is the amplitude of white noise mixed in, from 0 to 1.
+	Noise float64
+
+	// Voiced makes the tone sound more like someone talking: the
+	// harmonics of Frequency shaped by two formants, rising and
+	// falling like syllables.
+	Voiced bool
+}
+
+func Tone(frequency, amplitude float64, d time.Duration) Segment {
+	return Segment{Duration: d, Frequency: frequency, Amplitude: amplitude}
+}
+
+// Voice is a voiced sound at the given pitch, something like speech as
+// far as a voice detector can tell.
+func Voice(pitch, amplitude float64, d time.Duration) Segment {
+	return Segment{Duration: d, Frequency: pitch, Amplitude: amplitude, Voiced: true}
+}
+
+func Silence(d time.Duration) Segment {
+	return Segment{Duration: d}
+}
+
+func Noise(amplitude float64, d time.Duration) Segment {
+	return Segment{Duration: d, Noise: amplitude}
+}
+
+// GeneratorSource makes up mono audio from a list of segments, for
+// testing without a microphone. It ends after the last segment.
+type GeneratorSource struct {
+	rate     int
+	segments []Segment
+	pos      int
+	rand     *rand.Rand
+}
+
+func NewGeneratorSource(rate int, segments ...Segment) *GeneratorSource {
+	return &GeneratorSource{
+		rate:     rate,
+		segments: segments,
+		rand:     rand.New(rand.NewSource(1)),
+	}
+}
+
+func (g *GeneratorSource) SampleRate() int { return g.rate }
+func (g *GeneratorSource) Channels() int   { return 1 }
+
+func (g *GeneratorSource) Read(buf []int16) (int, error) {
+	var n int
+
+	for n < len(buf) {
+		seg, pos, ok := g.segment()
+		if !ok {
+			break
+		}
+
+		t := float64(pos) / float64(g.rate)
+
+		var v float64
+		if seg.Voiced {
+			v = seg.Amplitude * voiced(seg.Frequency, t, float64(g.rate))
+		} else {
+			v = seg.Amplitude * math.Sin(2*math.Pi*seg.Frequency*t)
+		}
+
+		if seg.Noise > 0 {
+			v += seg.Noise * (2*g.rand.Float64() - 1)
+		}
+
+		buf[n] = int16(math.Max(-1, math.Min(1, v)) * math.MaxInt16)
+
+		n++
+		g.pos++
+	}
+
+	if n == 0 {
+		return 0, io.EOF
+	}
+
+	return n, nil
+}
+
+// syllableRate is how many syllables a second a Voice segment has.
+const syllableRate = 4
+
+// voiced is the sample at t of a voice with the given pitch, peaking
+// at about 1.
+func voiced(pitch, t, rate float64) float64 {
+	var v float64
+
+	for f := pitch; f < rate/2 && f < 4000; f += pitch {
+		w := math.Exp(-math.Pow((f-600)/200, 2)) + 0.5*math.Exp(-math.Pow((f-1500)/300, 2)) + 0.05
+		v += w * math.Sin(2*math.Pi*f*t)
+	}
+
+	envelope := 0.6 + 0.4*math.Sin(2*math.Pi*syllableRate*t)
+
+	return 0.5 * v * envelope
+}
+
+// segment returns the segment the current sample is in and the
+// sample's position within it.
+func (g *GeneratorSource) segment() (Segment, int, bool) {
+	pos := g.pos
+
+	for _, seg := range g.segments {
+		samples := int(seg.Duration * time.Duration(g.rate) / time.Second)
+		if pos < samples {
+			return seg, pos, true
+		}
+
+		pos -= samples
+	}
+
+	return Segment{}, 0, false
+}
+
+func (g *GeneratorSource) Close() error {
+	return nil
+}
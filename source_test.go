@@ -0,0 +1,84 @@
+package alexa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// chunkReader hands out at most n bytes of r at a time, the way a pipe
+// might.
+type chunkReader struct {
+	r io.Reader
+	n int
+}
+
+func (c chunkReader) Read(p []byte) (int, error) {
+	if len(p) > c.n {
+		p = p[:c.n]
+	}
+
+	return c.r.Read(p)
+}
+
+func TestRawSourceOddReads(t *testing.T) {
+	want := make([]int16, 1000)
+	for i := range want {
+		want[i] = int16(i*37 - 18000)
+	}
+
+	var raw bytes.Buffer
+	binary.Write(&raw, binary.LittleEndian, want)
+
+	for _, r := range []io.Reader{
+		iotest.OneByteReader(bytes.NewReader(raw.Bytes())),
+		chunkReader{bytes.NewReader(raw.Bytes()), 3},
+		chunkReader{bytes.NewReader(raw.Bytes()), 101},
+	} {
+		var (
+			src = NewRawSource(r, 16000, 1)
+			got []int16
+			buf = make([]int16, 64)
+		)
+
+		for {
+			n, err := src.Read(buf)
+			got = append(got, buf[:n]...)
+
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("read %d samples, want %d", len(got), len(want))
+		}
+
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("sample %d is %d, want %d", i, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestRawSourceHalfSampleAtEnd(t *testing.T) {
+	src := NewRawSource(bytes.NewReader([]byte{1, 0, 2, 0, 3}), 16000, 1)
+	buf := make([]int16, 8)
+
+	n, err := src.Read(buf)
+	if n != 2 || err != nil || buf[0] != 1 || buf[1] != 2 {
+		t.Fatalf("got %v, %v, want [1 2]", buf[:n], err)
+	}
+
+	n, err = src.Read(buf)
+	if n != 0 || err != io.EOF {
+		t.Fatalf("got %d samples, %v, want io.EOF", n, err)
+	}
+}
@@ -0,0 +1,465 @@
+package alexa
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/audio/wav"
+)
+
+// Label marks a stretch of speech in a recording.
+type Label struct {
+	Start, End time.Duration
+}
+
+// LabelsPath is where the labels for a WAV file are kept: next to it,
+// with a .txt extension.
+func LabelsPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".txt"
+}
+
+// ReadLabels reads a label file as exported by Audacity: a line per
+// label, with the start and end in seconds and an optional name, all
+// separated by tabs or spaces.
+func ReadLabels(path string) ([]Label, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var (
+		labels []Label
+		lines  = bufio.NewScanner(f)
+		n      int
+	)
+
+	for lines.Scan() {
+		n++
+
+		fields := strings.Fields(lines.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: want a start and an end", path, n)
+		}
+
+		start, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, n, err)
+		}
+
+		end, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, n, err)
+		}
+
+		labels = append(labels, Label{
+			Start: time.Duration(start * float64(time.Second)),
+			End:   time.Duration(end * float64(time.Second)),
+		})
+	}
+
+	return labels, lines.Err()
+}
+
+// WriteLabels writes labels to path the way ReadLabels reads them,
+// all named speech, so Audacity can open them too.
+func WriteLabels(path string, labels []Label) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	for _, l := range labels {
+		_, err = fmt.Fprintf(f, "%.3f\t%.3f\tspeech\n", l.Start.Seconds(), l.End.Seconds())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// VADSample is a recording of a single utterance, 16kHz mono, with
+// where the speech in it is.
+type VADSample struct {
+	Name   string
+	Audio  []int16
+	Labels []Label
+}
+
+// ReadVADSample reads a WAV file and the labels next to it.
+func ReadVADSample(path string) (*VADSample, error) {
+	labels, err := ReadLabels(LabelsPath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := OpenWAVSource(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer src.Close()
+
+	audio, err := readAll(NewL16Source(src))
+	if err != nil {
+		return nil, err
+	}
+
+	return &VADSample{
+		Name:   filepath.Base(path),
+		Audio:  audio,
+		Labels: labels,
+	}, nil
+}
+
+func readAll(src AudioSource) ([]int16, error) {
+	var (
+		out []int16
+		buf = make([]int16, 4096)
+	)
+
+	for {
+		n, err := src.Read(buf)
+		out = append(out, buf[:n]...)
+
+		if err == io.EOF {
+			return out, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Write saves the sample as a WAV file in dir, with its labels.
+func (s *VADSample) Write(dir string) error {
+	path := filepath.Join(dir, s.Name)
+
+	w, err := wav.Create(path, wav.L16)
+	if err != nil {
+		return err
+	}
+
+	err = w.WriteInt16(s.Audio)
+	if err != nil {
+		w.Close()
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return WriteLabels(LabelsPath(path), s.Labels)
+}
+
+// SyntheticVADCorpus makes up utterances of different shapes over
+// different amounts of noise, the same ones for the same seed.
+func SyntheticVADCorpus(seed int64) []*VADSample {
+	var (
+		r      = rand.New(rand.NewSource(seed))
+		noises = []struct {
+			name  string
+			level float64
+		}{
+			{"quiet", 0.001},
+			{"fan", 0.01},
+			{"loud", 0.03},
+		}
+		shapes = []struct {
+			name   string
+			phrase []time.Duration
+		}{
+			{"short", []time.Duration{500 * time.Millisecond}},
+			{"phrase", []time.Duration{1500 * time.Millisecond}},
+			{"pause", []time.Duration{time.Second, 400 * time.Millisecond, 800 * time.Millisecond}},
+		}
+		corpus []*VADSample
+	)
+
+	ms := func(lo, hi int) time.Duration {
+		return time.Duration(lo+r.Intn(hi-lo)) * time.Millisecond
+	}
+
+	for _, noise := range noises {
+		for _, shape := range shapes {
+			var (
+				segs   []Segment
+				labels []Label
+				pitch  = 100 + 120*r.Float64()
+				pos    = ms(1000, 2000)
+			)
+
+			segs = append(segs, Noise(noise.level, pos))
+
+			for i, d := range shape.phrase {
+				if i%2 == 1 {
+					segs = append(segs, Noise(noise.level, d))
+					pos += d
+					continue
+				}
+
+				seg := Voice(pitch, 0.3, d)
+				seg.Noise = noise.level
+
+				segs = append(segs, seg)
+				labels = append(labels, Label{Start: pos, End: pos + d})
+				pos += d
+			}
+
+			segs = append(segs, Noise(noise.level, 2*time.Second))
+
+			audio, _ := readAll(NewGeneratorSource(16000, segs...))
+
+			corpus = append(corpus, &VADSample{
+				Name:   fmt.Sprintf("%s-%s.wav", noise.name, shape.name),
+				Audio:  audio,
+				Labels: labels,
+			})
+		}
+	}
+
+	return corpus
+}
+
+// VADResult is how well voice detection and endpointing did on a
+// VADSample.
+type VADResult struct {
+	Name string
+
+	// Frames and Correct count the frames, and those the endpointer
+	// got right about being speech or not.
+	Frames, Correct int
+
+	// Started is whether speech was heard at all, and StartLatency how
+	// long after it began. It's negative for starting too early.
+	Started      bool
+	StartLatency time.Duration
+
+	// EarlyCutoff is whether the utterance was ended before the last
+	// of the speech.
+	EarlyCutoff bool
+
+	// TrailingSilence is how much audio after the speech was sent
+	// before the utterance ended.
+	TrailingSilence time.Duration
+}
+
+func (r VADResult) Accuracy() float64 {
+	if r.Frames == 0 {
+		return 0
+	}
+
+	return float64(r.Correct) / float64(r.Frames)
+}
+
+func (s *VADSample) speech(t time.Duration) bool {
+	for _, l := range s.Labels {
+		if t >= l.Start && t < l.End {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EvaluateVAD runs a detector from newDetector and the endpointer over
+// the sample, as if it was being listened to, and sees how they did.
+// Neither knows the noise floor of whatever was evaluated before.
+func EvaluateVAD(newDetector func() VoiceDetector, ep Endpointer, s *VADSample) VADResult {
+	var (
+		r     = VADResult{Name: s.Name}
+		d     = newDetector()
+		ended bool
+		end   time.Duration
+	)
+
+	ep.Reset()
+	ep.Noise = NoiseFloor{Window: ep.Noise.Window, SampleRate: ep.Noise.SampleRate}
+
+	at := func(samples int) time.Duration {
+		return time.Duration(samples) * time.Second / 16000
+	}
+
+	for pos := 0; pos+ListenFrame <= len(s.Audio); pos += ListenFrame {
+		frame := s.Audio[pos : pos+ListenFrame]
+
+		switch ep.Push(d.Detect(frame), frame) {
+		case SpeechStarted:
+			if !r.Started && len(s.Labels) > 0 {
+				r.Started = true
+				r.StartLatency = at(pos+ListenFrame) - s.Labels[0].Start
+			}
+		case SpeechEnded:
+			if !ended {
+				ended = true
+				end = at(pos + ListenFrame)
+			}
+		}
+
+		r.Frames++
+		if ep.Speech() == s.speech(at(pos+ListenFrame/2)) {
+			r.Correct++
+		}
+	}
+
+	if !ended {
+		end = at(len(s.Audio))
+	}
+
+	if len(s.Labels) > 0 && r.Started {
+		last := s.Labels[len(s.Labels)-1].End
+
+		r.EarlyCutoff = end < last
+		if end > last {
+			r.TrailingSilence = end - last
+		}
+	}
+
+	return r
+}
+
+type VADEvalCommand struct {
+	VAD      string `long:"vad" description:"detector to evaluate; all of them if not given" choice:"flux" choice:"energy" choice:"band"`
+	Generate string `long:"generate" description:"write the synthetic corpus to this directory and stop"`
+	Verbose  bool   `short:"v" long:"verbose" description:"show the result for every file"`
+
+	StartDuration time.Duration `long:"start" default:"60ms" description:"how much speech starts an utterance"`
+	Hangover      time.Duration `long:"hangover" default:"100ms" description:"how long speech is assumed to go on after the last of it is heard"`
+	QuietDuration time.Duration `long:"quiet" default:"1s" description:"how much quiet ends an utterance"`
+}
+
+func (v *VADEvalCommand) Execute(args []string) error {
+	if v.Generate != "" {
+		err := os.MkdirAll(v.Generate, 0755)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range SyntheticVADCorpus(1) {
+			err = s.Write(v.Generate)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	var corpus []*VADSample
+
+	for _, path := range args {
+		s, err := ReadVADSample(path)
+		if err != nil {
+			return err
+		}
+
+		corpus = append(corpus, s)
+	}
+
+	if len(corpus) == 0 {
+		corpus = SyntheticVADCorpus(1)
+	}
+
+	names := VoiceDetectors
+	if v.VAD != "" {
+		names = []string{v.VAD}
+	}
+
+	ep := Endpointer{
+		StartDuration: v.StartDuration,
+		Hangover:      v.Hangover,
+		QuietDuration: v.QuietDuration,
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "vad\tfile\taccuracy\tmissed\tstart latency\tearly cutoffs\ttrailing silence")
+
+	for _, name := range names {
+		_, err := NewVoiceDetector(name)
+		if err != nil {
+			return err
+		}
+
+		newDetector := func() VoiceDetector {
+			d, _ := NewVoiceDetector(name)
+			return d
+		}
+
+		var results []VADResult
+
+		for _, s := range corpus {
+			r := EvaluateVAD(newDetector, ep, s)
+			results = append(results, r)
+
+			if v.Verbose {
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", name, r.Name, vadRow([]VADResult{r}))
+			}
+		}
+
+		fmt.Fprintf(tw, "%s\t(all %d)\t%s\n", name, len(results), vadRow(results))
+	}
+
+	return nil
+}
+
+// vadRow sums up results: the overall accuracy, how many were never
+// heard, and the average start latency, cutoffs and trailing silence
+// of the rest.
+func vadRow(results []VADResult) string {
+	var (
+		frames, correct int
+		missed, cutoffs int
+		latency, trail  time.Duration
+	)
+
+	for _, r := range results {
+		frames += r.Frames
+		correct += r.Correct
+
+		if !r.Started {
+			missed++
+			continue
+		}
+
+		latency += r.StartLatency
+		trail += r.TrailingSilence
+
+		if r.EarlyCutoff {
+			cutoffs++
+		}
+	}
+
+	var accuracy float64
+	if frames > 0 {
+		accuracy = float64(correct) / float64(frames)
+	}
+
+	if heard := len(results) - missed; heard > 0 {
+		latency /= time.Duration(heard)
+		trail /= time.Duration(heard)
+	}
+
+	return fmt.Sprintf("%.1f%%\t%d\t%s\t%d\t%s",
+		100*accuracy, missed, latency.Round(time.Millisecond), cutoffs, trail.Round(time.Millisecond))
+}
@@ -0,0 +1,95 @@
+package alexa
+
+import (
+	"testing"
+	"time"
+)
+
+func newDetector(name string) func() VoiceDetector {
+	return func() VoiceDetector {
+		d, _ := NewVoiceDetector(name)
+		return d
+	}
+}
+
+var evalEndpointer = Endpointer{
+	StartDuration: 60 * time.Millisecond,
+	Hangover:      100 * time.Millisecond,
+	QuietDuration: time.Second,
+}
+
+// What the detectors do on the synthetic corpus now; a change that
+// makes any of them worse fails.
+var vadBaseline = map[string]struct {
+	accuracy   float64
+	missed     int
+	maxLatency time.Duration
+}{
+	"flux":   {0.93, 1, 600 * time.Millisecond},
+	"energy": {0.97, 0, 100 * time.Millisecond},
+	"band":   {0.97, 0, 100 * time.Millisecond},
+}
+
+func TestEvaluateVADSynthetic(t *testing.T) {
+	corpus := SyntheticVADCorpus(1)
+
+	for _, name := range VoiceDetectors {
+		var (
+			want            = vadBaseline[name]
+			frames, correct int
+			missed          int
+		)
+
+		for _, s := range corpus {
+			r := EvaluateVAD(newDetector(name), evalEndpointer, s)
+
+			frames += r.Frames
+			correct += r.Correct
+
+			if !r.Started {
+				missed++
+				continue
+			}
+
+			if r.StartLatency < 0 || r.StartLatency > want.maxLatency {
+				t.Errorf("%s: %s started %v after the speech", name, s.Name, r.StartLatency)
+			}
+
+			if r.EarlyCutoff {
+				t.Errorf("%s: %s was cut off early", name, s.Name)
+			}
+
+			if r.TrailingSilence > 1300*time.Millisecond {
+				t.Errorf("%s: %s sent %v of silence after the speech", name, s.Name, r.TrailingSilence)
+			}
+		}
+
+		if accuracy := float64(correct) / float64(frames); accuracy < want.accuracy {
+			t.Errorf("%s: %.1f%% of frames right, want at least %.0f%%", name, 100*accuracy, 100*want.accuracy)
+		}
+
+		if missed > want.missed {
+			t.Errorf("%s: missed %d utterances, want at most %d", name, missed, want.missed)
+		}
+	}
+}
+
+func TestEvaluateVADForgetsTheRoom(t *testing.T) {
+	// An endpointer that has been listening to a quiet room.
+	used := evalEndpointer
+	quiet := generate(Noise(0.0005, 5*time.Second))
+
+	for pos := 0; pos+ListenFrame <= len(quiet); pos += ListenFrame {
+		used.Push(0, quiet[pos:pos+ListenFrame])
+	}
+
+	for _, name := range VoiceDetectors {
+		for _, s := range SyntheticVADCorpus(1) {
+			fresh := EvaluateVAD(newDetector(name), evalEndpointer, s)
+
+			if r := EvaluateVAD(newDetector(name), used, s); r != fresh {
+				t.Errorf("%s: %s came out as %+v after a quiet room, %+v fresh", name, s.Name, r, fresh)
+			}
+		}
+	}
+}
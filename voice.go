@@ -0,0 +1,248 @@
+package alexa
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Fruchtgummi/alexa/features"
+)
+
+// VoiceDetector decides, a frame at a time, whether someone is
+// talking. When they start and stop is left to an Endpointer.
+type VoiceDetector interface {
+	// Detect takes the next frame of 16kHz mono audio and returns how
+	// likely it is to be speech, from 0 to 1.
+	Detect(frame []int16) float64
+
+	// Reset forgets everything heard so far, for a new utterance.
+	Reset()
+}
+
+// VoiceDetectors are the names NewVoiceDetector knows.
+var VoiceDetectors = []string{"flux", "energy", "band"}
+
+func NewVoiceDetector(name string) (VoiceDetector, error) {
+	switch name {
+	case "", "flux":
+		return NewFluxDetector(), nil
+	case "energy":
+		return NewEnergyDetector(), nil
+	case "band":
+		return NewBandDetector(), nil
+	default:
+		return nil, fmt.Errorf("unknown voice detector %q", name)
+	}
+}
+
+// fluxWindow is how many samples the spectral flux is taken over.
+const fluxWindow = 8196
+
+// FluxDetector is the original detector: speech starts when the
+// spectral flux jumps by 75% and stops being heard when it falls back
+// below 1/1.75 of its level. It looks at half a second at a time, so
+// its answer only changes that often.
+type FluxDetector struct {
+	vad      *VAD
+	buf      []int16
+	lastFlux float64
+	heard    bool
+	speech   bool
+}
+
+func NewFluxDetector() *FluxDetector {
+	return &FluxDetector{
+		vad: NewVAD(fluxWindow),
+		buf: make([]int16, 0, fluxWindow),
+	}
+}
+
+func (f *FluxDetector) Detect(frame []int16) float64 {
+	for len(frame) > 0 {
+		n := copy(f.buf[len(f.buf):cap(f.buf)], frame)
+		f.buf = f.buf[:len(f.buf)+n]
+		frame = frame[n:]
+
+		if len(f.buf) == cap(f.buf) {
+			f.window(f.vad.Flux(f.buf))
+			f.buf = f.buf[:0]
+		}
+	}
+
+	if f.speech {
+		return 1
+	}
+
+	return 0
+}
+
+// Delay is how long, in samples, speech can have been going on before
+// the detector notices: a whole window.
+func (f *FluxDetector) Delay() int {
+	return fluxWindow
+}
+
+func (f *FluxDetector) window(flux float64) {
+	switch {
+	case f.lastFlux == 0:
+		f.lastFlux = flux
+	case f.heard:
+		if flux*1.75 <= f.lastFlux {
+			f.speech = false
+		} else {
+			f.speech = true
+			f.lastFlux = flux
+		}
+	default:
+		if flux >= f.lastFlux*1.75 {
+			f.heard = true
+			f.speech = true
+		}
+
+		f.lastFlux = flux
+	}
+}
+
+func (f *FluxDetector) Reset() {
+	f.buf = f.buf[:0]
+	f.lastFlux = 0
+	f.heard = false
+	f.speech = false
+}
+
+// logistic maps x to 0..1, crossing 0.5 at zero.
+func logistic(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+// decibels is the power of samples in dB relative to full scale.
+func decibels(samples []int16) float64 {
+	var sum float64
+
+	for _, s := range samples {
+		v := float64(s) / (1 << 15)
+		sum += v * v
+	}
+
+	return 10 * math.Log10(sum/float64(len(samples))+1e-12)
+}
+
+// EnergyDetector counts a frame as speech when it is well above the
+// noise floor, or a little above it with the many zero crossings of
+// fricatives like s and f, which carry little energy.
+type EnergyDetector struct {
+	// Margin is how many dB above the noise floor is certainly
+	// speech.
+	Margin float64
+
+	floor NoiseFloor
+}
+
+func NewEnergyDetector() *EnergyDetector {
+	return &EnergyDetector{
+		Margin: 12,
+	}
+}
+
+// zeroCrossings is the fraction of samples where the signal changes
+// sign.
+func zeroCrossings(samples []int16) float64 {
+	var n int
+
+	for i := 1; i < len(samples); i++ {
+		if (samples[i-1] < 0) != (samples[i] < 0) {
+			n++
+		}
+	}
+
+	return float64(n) / float64(len(samples))
+}
+
+func (e *EnergyDetector) Detect(frame []int16) float64 {
+	db := decibels(frame)
+	above := db - e.floor.Update(db, len(frame))
+
+	p := logistic((above - e.Margin) / 2)
+
+	if zcr := zeroCrossings(frame); zcr > 0.3 && above > e.Margin/2 {
+		p = math.Max(p, 0.6)
+	}
+
+	return p
+}
+
+// Reset keeps the noise floor, the room hasn't changed.
+func (e *EnergyDetector) Reset() {}
+
+// BandDetector looks at how much of a frame's energy is in the
+// 300-3400Hz telephone band, where most of speech is, as well as how
+// loud it is, so that hum and hiss are not mistaken for speech.
+type BandDetector struct {
+	// Margin is how many dB above the noise floor is certainly
+	// speech.
+	Margin float64
+
+	// Ratio is the share of energy in the band above which a frame is
+	// taken as speech.
+	Ratio float64
+
+	ext       *features.Extractor
+	low, high int
+	ratio     float64
+	frames    int
+	floor     NoiseFloor
+}
+
+func NewBandDetector() *BandDetector {
+	cfg := features.DefaultConfig()
+	cfg.PreEmphasis = 0
+
+	binHz := float64(cfg.SampleRate) / float64(cfg.FFTSize)
+
+	return &BandDetector{
+		Margin: 9,
+		Ratio:  0.6,
+		ext:    features.New(cfg),
+		low:    int(300 / binHz),
+		high:   int(3400/binHz) + 1,
+	}
+}
+
+func (b *BandDetector) Detect(frame []int16) float64 {
+	b.ratio, b.frames = 0, 0
+
+	b.ext.Process(frame, b.band)
+
+	if b.frames == 0 {
+		return 0
+	}
+
+	var (
+		db    = decibels(frame)
+		above = db - b.floor.Update(db, len(frame))
+		ratio = b.ratio / float64(b.frames)
+	)
+
+	return logistic((above-b.Margin)/2) * logistic((ratio-b.Ratio)*20)
+}
+
+func (b *BandDetector) band(f *features.Frame) {
+	var in, total float64
+
+	for i, p := range f.Power {
+		total += p
+		if i >= b.low && i < b.high {
+			in += p
+		}
+	}
+
+	if total > 0 {
+		b.ratio += in / total
+	}
+
+	b.frames++
+}
+
+// Reset keeps the noise floor, the room hasn't changed.
+func (b *BandDetector) Reset() {
+	b.ext.Reset()
+}
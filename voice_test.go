@@ -0,0 +1,70 @@
+package alexa
+
+import (
+	"testing"
+	"time"
+)
+
+// speechShare is the share of the frames of seg, after a couple of
+// seconds of a quiet room, that d takes for speech.
+func speechShare(d VoiceDetector, seg Segment) float64 {
+	var (
+		room    = generate(Noise(0.002, 2*time.Second))
+		samples = generate(seg)
+		speech  int
+		frames  int
+	)
+
+	for i := 0; i+ListenFrame <= len(room); i += ListenFrame {
+		d.Detect(room[i : i+ListenFrame])
+	}
+
+	for i := 0; i+ListenFrame <= len(samples); i += ListenFrame {
+		if d.Detect(samples[i:i+ListenFrame]) > 0.5 {
+			speech++
+		}
+
+		frames++
+	}
+
+	return float64(speech) / float64(frames)
+}
+
+func TestVoiceDetectors(t *testing.T) {
+	for _, name := range []string{"energy", "band"} {
+		for _, c := range []struct {
+			seg    Segment
+			speech bool
+
+			// only is the one detector the case is for, if it's
+			// just one.
+			only string
+		}{
+			{seg: burst(0.002, time.Second), speech: true},
+			{seg: Voice(220, 0.1, time.Second), speech: true},
+			{seg: Noise(0.002, time.Second)},
+			{seg: Silence(time.Second)},
+
+			// Mains hum is loud but below the band speech is in.
+			{seg: Tone(50, 0.3, time.Second), only: "band"},
+		} {
+			if c.only != "" && c.only != name {
+				continue
+			}
+
+			d, err := NewVoiceDetector(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			share := speechShare(d, c.seg)
+
+			switch {
+			case c.speech && share < 0.9:
+				t.Errorf("%s: %+v taken for speech %.0f%% of the time", name, c.seg, 100*share)
+			case !c.speech && share > 0.05:
+				t.Errorf("%s: %+v taken for speech %.0f%% of the time", name, c.seg, 100*share)
+			}
+		}
+	}
+}
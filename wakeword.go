@@ -0,0 +1,154 @@
+package alexa
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"time"
+)
+
+// SpotterFrame is how many samples of 16kHz mono audio a
+// KeywordSpotter is given at a time, 20ms.
+const SpotterFrame = 320
+
+// KeywordSpotter listens for the wake word.
+type KeywordSpotter interface {
+	// Spot takes the next SpotterFrame samples of 16kHz mono audio and
+	// reports whether the wake word was heard.
+	Spot(frame []int16) bool
+
+	// Reset forgets everything heard so far, so a wake word that was
+	// already reported isn't reported again.
+	Reset()
+}
+
+// CommandSpotter leaves spotting to another program, such as one of
+// the many keyword spotting demos. It's fed 16kHz mono L16 on stdin and
+// prints a line every time it hears the wake word.
+type CommandSpotter struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	hits  int32
+}
+
+func StartCommandSpotter(command string) (*CommandSpotter, error) {
+	s := &CommandSpotter{
+		cmd: exec.Command("sh", "-c", command),
+	}
+
+	s.cmd.Stderr = os.Stderr
+
+	var err error
+
+	s.stdin, err = s.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := s.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		lines := bufio.NewScanner(stdout)
+		for lines.Scan() {
+			atomic.AddInt32(&s.hits, 1)
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *CommandSpotter) Spot(frame []int16) bool {
+	err := binary.Write(s.stdin, binary.LittleEndian, frame)
+	if err != nil {
+		return false
+	}
+
+	return atomic.SwapInt32(&s.hits, 0) > 0
+}
+
+func (s *CommandSpotter) Reset() {
+	atomic.StoreInt32(&s.hits, 0)
+}
+
+func (s *CommandSpotter) Close() error {
+	s.stdin.Close()
+	return s.cmd.Wait()
+}
+
+// SpotSource runs the spotter over all of src and returns how far into
+// it each detection was.
+func SpotSource(spotter KeywordSpotter, src AudioSource) ([]time.Duration, error) {
+	var (
+		hits  []time.Duration
+		frame = make([]int16, SpotterFrame)
+		pos   int
+	)
+
+	src = NewL16Source(src)
+
+	for {
+		err := readFull(src, frame)
+		if err == io.EOF {
+			return hits, nil
+		}
+
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return hits, err
+		}
+
+		pos += len(frame)
+
+		if spotter.Spot(frame) {
+			hits = append(hits, time.Duration(pos)*time.Second/16000)
+			spotter.Reset()
+		}
+
+		if err != nil {
+			return hits, nil
+		}
+	}
+}
+
+// SpotFile is SpotSource for a WAV file.
+func SpotFile(spotter KeywordSpotter, path string) ([]time.Duration, error) {
+	src, err := OpenWAVSource(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer src.Close()
+
+	return SpotSource(spotter, src)
+}
+
+// prerolledSource plays back the audio from before the wake word and
+// then carries on with the live source, which it doesn't close.
+type prerolledSource struct {
+	AudioSource
+	pre []int16
+}
+
+func (p *prerolledSource) Read(buf []int16) (int, error) {
+	if len(p.pre) > 0 {
+		n := copy(buf, p.pre)
+		p.pre = p.pre[n:]
+		return n, nil
+	}
+
+	return p.AudioSource.Read(buf)
+}
+
+func (p *prerolledSource) Close() error {
+	return nil
+}
@@ -0,0 +1,229 @@
+package alexa
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Fruchtgummi/alexa/audio/wav"
+	"github.com/Fruchtgummi/alexa/avs/avstest"
+)
+
+// The fixtures in testdata/wake are made up: the same made up word,
+// a few tones in a row, said three times to enroll and once in
+// keyword.wav, at 1.42s, and a different one in other.wav.
+func enrolledWakeWord(t *testing.T) *WakeWord {
+	var recordings [][]int16
+
+	for _, name := range []string{"enroll-1.wav", "enroll-2.wav", "enroll-3.wav"} {
+		r, err := wav.Open(filepath.Join("testdata", "wake", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		samples, err := wav.ReadL16(r)
+		r.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recordings = append(recordings, samples)
+	}
+
+	w, err := NewWakeWord(recordings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return w
+}
+
+func TestSpotFile(t *testing.T) {
+	w := enrolledWakeWord(t)
+
+	hits, err := SpotFile(NewTemplateSpotter(w), filepath.Join("testdata", "wake", "keyword.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hits) != 1 || hits[0] < 1400*time.Millisecond || hits[0] > 1800*time.Millisecond {
+		t.Errorf("keyword.wav: wake word spotted at %v, want once just after 1.42s", hits)
+	}
+
+	hits, err = SpotFile(NewTemplateSpotter(w), filepath.Join("testdata", "wake", "other.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hits) != 0 {
+		t.Errorf("other.wav: wake word spotted at %v, want never", hits)
+	}
+}
+
+// wakeMarker starts a frame that markerSpotter takes for the wake
+// word.
+const wakeMarker = 12345
+
+type markerSpotter struct {
+	lock   sync.Mutex
+	frames int
+	hits   int
+}
+
+func (s *markerSpotter) Spot(frame []int16) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.frames++
+
+	if frame[0] != wakeMarker {
+		return false
+	}
+
+	s.hits++
+	return true
+}
+
+func (s *markerSpotter) Reset() {}
+
+func (s *markerSpotter) counts() (frames, hits int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.frames, s.hits
+}
+
+// answeringPlayer holds on to the first answer until answered is
+// closed.
+type answeringPlayer struct {
+	fakePlayer
+	answering chan struct{}
+	answered  chan struct{}
+	once      sync.Once
+}
+
+func (p *answeringPlayer) Play(io.Reader) error {
+	p.once.Do(func() {
+		close(p.answering)
+		<-p.answered
+	})
+
+	return nil
+}
+
+// generate is all of the audio made up of segments, at 16kHz.
+func generate(segments ...Segment) []int16 {
+	var (
+		src = NewGeneratorSource(16000, segments...)
+		out []int16
+		buf = make([]int16, 1024)
+	)
+
+	for {
+		n, err := src.Read(buf)
+		out = append(out, buf[:n]...)
+
+		if err != nil {
+			return out
+		}
+	}
+}
+
+// feed queues samples on c a frame at a time, waiting for room rather
+// than dropping any.
+func feed(c *Capture, samples []int16) {
+	for len(samples) >= c.size {
+		for len(c.frames) == cap(c.frames) {
+			time.Sleep(time.Millisecond)
+		}
+
+		c.write(samples[:c.size])
+		samples = samples[c.size:]
+	}
+}
+
+func markerFrame() []int16 {
+	f := make([]int16, SpotterFrame)
+	for i := range f {
+		f[i] = wakeMarker
+	}
+
+	return f
+}
+
+func TestWakeListenerSkipsAudioFromTheAnswer(t *testing.T) {
+	var (
+		s       = &avstest.Server{Speech: []byte("answer")}
+		mic     = newCapture(16000, 1, SpotterFrame)
+		spotter = &markerSpotter{}
+		player  = &answeringPlayer{
+			answering: make(chan struct{}),
+			answered:  make(chan struct{}),
+		}
+	)
+
+	w := &WakeListener{
+		Source:  mic,
+		Spotter: spotter,
+		Client:  testClient(t, s),
+		PreRoll: 200 * time.Millisecond,
+		Opts: ListenOpts{
+			Detector: NewEnergyDetector(),
+			Player:   player,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ran := make(chan error, 1)
+
+	go func() {
+		ran <- w.Run(ctx)
+	}()
+
+	// The wake word and a question, then the wake word again while
+	// alexa is answering, as the microphone would hear her.
+	feed(mic, generate(Noise(0.002, 500*time.Millisecond)))
+	feed(mic, markerFrame())
+	feed(mic, generate(Voice(150, 0.3, time.Second), Noise(0.002, 1400*time.Millisecond)))
+
+	select {
+	case <-player.answering:
+	case <-time.After(10 * time.Second):
+		t.Fatal("alexa never answered")
+	}
+
+	for i := 0; i < 10; i++ {
+		feed(mic, markerFrame())
+	}
+
+	close(player.answered)
+
+	frames, _ := spotter.counts()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if f, _ := spotter.counts(); f >= frames+25 {
+			break
+		}
+
+		feed(mic, generate(Noise(0.002, 20*time.Millisecond)))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	feed(mic, generate(Noise(0.002, 20*time.Millisecond)))
+
+	err := <-ran
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, hits := spotter.counts(); hits != 1 {
+		t.Errorf("wake word spotted %d times, want once; the audio from during the answer wasn't dropped", hits)
+	}
+}